@@ -21,12 +21,14 @@ var SHEET_NAMES = struct {
 	EMAIL_LOGGER string // Sheet ghi log OTP/Email
 	POST_LOGGER  string // Sheet ghi log lịch sử đăng bài
 	ERROR_LOGGER string // Sheet ghi log lỗi hệ thống
+	PROXY        string // Sheet kho Proxy (Tự cấp Proxy cho nick khi Login)
 }{
 	USER_NAME:    "UserName",
 	DATA_TIKTOK:  "DataTiktok",
 	EMAIL_LOGGER: "EmailLogger",
 	POST_LOGGER:  "PostLogger",
 	ERROR_LOGGER: "ErrorLogger",
+	PROXY:        "Proxy",
 }
 
 // Bản đồ ánh xạ để copy sheet mẫu khi tạo mới cho user
@@ -35,6 +37,7 @@ var TEMPLATE_SHEETS = map[string]string{
 	"DataTiktok":  "Mẫu DataTiktok",
 	"EmailLogger": "Mẫu EmailLogger",
 	"PostLogger":  "Mẫu PostLogger",
+	"Proxy":       "Mẫu Proxy",
 }
 
 // =================================================================================================
@@ -66,21 +69,31 @@ var RANGES = struct {
 // =================================================================================================
 
 var CACHE = struct {
-	SHEET_VALID_MS  int64 // Thời gian sống của Cache Sheet (5 phút)
-	SHEET_ERROR_MS  int64 // Thời gian chờ nếu Cache bị lỗi (1 phút)
-	SHEET_MAX_KEYS  int   // Số lượng file Excel tối đa lưu trong RAM
-	TOKEN_MAX_KEYS  int   // Số lượng Token User tối đa lưu trong RAM
-	MAIL_CACHE_TTL  int64 // Thời gian Cache kết quả đọc Mail (10 giây)
-	TOKEN_TTL_MS    int64 // Thời gian sống của Token trong RAM (1 giờ)
-	CLEAN_COL_LIMIT int   // Số cột cần "làm sạch" (Trim/Lowercase) để tìm kiếm nhanh
+	SHEET_VALID_MS  int64  // Thời gian sống của Cache Sheet (5 phút)
+	SHEET_ERROR_MS  int64  // Thời gian chờ nếu Cache bị lỗi (1 phút)
+	SHEET_STALE_MS  int64  // Hết hạn nhưng chưa quá mốc này -> Vẫn trả bản cũ & nạp lại ở nền
+	SHEET_MAX_KEYS  int    // Số lượng file Excel tối đa lưu trong RAM
+	SHEET_MAX_BYTES int64  // Tổng dung lượng RAM tối đa cho Cache Sheet (Ước lượng)
+	TOKEN_MAX_KEYS  int    // Số lượng Token User tối đa lưu trong RAM
+	MAIL_CACHE_TTL  int64  // Thời gian Cache kết quả đọc Mail (10 giây)
+	TOKEN_TTL_MS    int64  // Thời gian sống của Token trong RAM (1 giờ)
+	CLEAN_COL_LIMIT int    // Số cột cần "làm sạch" (Trim/Lowercase) để tìm kiếm nhanh
+	CHANGE_CHECK_MS int64  // Chu kỳ dò chỉnh sửa tay trên Sheet (Hỏi phiên bản trước, đổi mới đọc cả Sheet & so Fingerprint)
+	CHANGE_FULL_MS  int64  // Phiên bản không đổi quá mốc này -> Vẫn đọc cả Sheet 1 lần (Drive cập nhật modifiedTime có độ trễ)
+	CONFLICT_POLICY string // Xung đột (Sheet & Queue cùng sửa 1 ô): "sheet" = Operator thắng | "queue" = Tool thắng
 }{
 	SHEET_VALID_MS:  300000,  // 300s = 5 phút
 	SHEET_ERROR_MS:  60000,   // 60s = 1 phút
+	SHEET_STALE_MS:  120000,  // 2 phút
 	SHEET_MAX_KEYS:  50,      // Max 50 files
+	SHEET_MAX_BYTES: 1 << 30, // 1GB
 	TOKEN_MAX_KEYS:  5000,    // Max 5000 tokens
 	MAIL_CACHE_TTL:  10000,   // 10s
 	TOKEN_TTL_MS:    3600000, // 1h
 	CLEAN_COL_LIMIT: 61,      // Cache sạch 61 cột
+	CHANGE_CHECK_MS: 30000,   // 30s
+	CHANGE_FULL_MS:  300000,  // 5 phút
+	CONFLICT_POLICY: "sheet", // Ưu tiên chỉnh sửa tay của Operator
 }
 
 // =================================================================================================
@@ -94,6 +107,14 @@ var TOKEN_RULES = struct {
 	MIN_LENGTH     int   // Độ dài tối thiểu của token hợp lệ
 	CACHE_TTL_MS   int64 // Thời gian lưu Cache Token đúng (trùng với CACHE.TOKEN_TTL_MS)
 	BLOCK_TTL_MS   int64 // Thời gian chặn Token sai (1 phút)
+	SWEEP_MS       int64 // Chu kỳ Janitor dọn Token/Rate Limit hết hạn
+	RATE_IDLE_MS   int64 // Bản ghi Rate Limit nhàn rỗi quá lâu sẽ bị dọn
+	RATE_MAX_KEYS  int   // Số bản ghi Rate Limit tối đa trong RAM
+	SECRET_BYTES   int   // Số byte ngẫu nhiên của Token cấp qua /tool/tokens (Hex -> Gấp đôi ký tự)
+	DEFAULT_DAYS   int   // Hạn mặc định của Token mới (Ngày)
+	WATCH_MS       int64 // Chu kỳ dò thay đổi Node TOKEN_TIKTOK (Thu hồi / Gia hạn / Đổi Sheet)
+	MAX_DAYS       int      // Hạn tối đa của Token cấp / gia hạn qua /tool/tokens (Ngày, tính từ hiện tại)
+	DATA_KEYS      []string // Khóa cấu hình được ghi qua "data" của /tool/tokens
 }{
 	GLOBAL_MAX_REQ: 1000,    // 1000 req/s toàn server
 	TOKEN_MAX_REQ:  5,       // 5 req/s mỗi user
@@ -101,15 +122,31 @@ var TOKEN_RULES = struct {
 	MIN_LENGTH:     10,      // Token < 10 ký tự là rác
 	CACHE_TTL_MS:   3600000, // 1 giờ
 	BLOCK_TTL_MS:   60000,   // 1 phút
+	SWEEP_MS:       30000,   // 30 giây
+	RATE_IDLE_MS:   60000,   // 1 phút không request
+	RATE_MAX_KEYS:  10000,   // 10.000 bản ghi
+	SECRET_BYTES:   24,      // 48 ký tự Hex
+	DEFAULT_DAYS:   30,      // 30 ngày
+	WATCH_MS:       5000,    // 5 giây
+	MAX_DAYS:       366,     // 1 năm
+	DATA_KEYS:      []string{"timezone", "device_slots", "proxy_pool", "funnels", "rotation"},
 }
 
 // Cấu hình hàng đợi ghi dữ liệu (Write Queue)
 var QUEUE = struct {
-	FLUSH_INTERVAL_MS int64 // Thời gian xả hàng đợi xuống đĩa (3 giây/lần)
-	BATCH_LIMIT_BASE  int   // Số lượng dòng tối đa cho 1 lần ghi
+	FLUSH_INTERVAL_MS int64  // Thời gian xả hàng đợi xuống đĩa (3 giây/lần)
+	BATCH_LIMIT_BASE  int    // Số lượng dòng tối đa cho 1 lần ghi
+	BATCH_MAX_BYTES   int    // Dung lượng ước tính tối đa cho 1 lần gọi API (Google khuyên < 2MB)
+	JOURNAL_DIR       string // Thư mục chứa file WAL của Queue (Env WAL_DIR ghi đè)
+	MAX_RETRY         int    // Số lần ghi lỗi tối đa trước khi chuyển vào Dead-letter
+	RETRY_MAX_MS      int64  // Thời gian chờ tối đa giữa 2 lần thử lại (Backoff)
 }{
-	FLUSH_INTERVAL_MS: 1000, // 3 giây
-	BATCH_LIMIT_BASE:  500,  // 500 dòng
+	FLUSH_INTERVAL_MS: 1000,    // 3 giây
+	BATCH_LIMIT_BASE:  500,     // 500 dòng
+	BATCH_MAX_BYTES:   1 << 20, // 1MB
+	JOURNAL_DIR:       "./wal", // Nên mount Volume để sống sót qua Restart
+	MAX_RETRY:         6,       // 6 lần (~2 phút với Backoff)
+	RETRY_MAX_MS:      60000,   // 60 giây
 }
 
 // =================================================================================================
@@ -156,6 +193,13 @@ var INDEX_DATA_TIKTOK = struct {
 	TARGET_AUDIENCE: 55, VISUAL_STYLE: 56, AI_PERSONA: 57, BANNED_KEYWORDS: 58, CONTENT_LANGUAGE: 59, COUNTRY: 60,
 }
 
+// Sheet Proxy: 1 dòng = 1 Proxy
+var INDEX_PROXY = struct {
+	PROXY int; TYPE int; EXPIRED int; MAX_ACCOUNTS int; STATUS int; COUNTRY int; NOTE int;
+}{
+	PROXY: 0, TYPE: 1, EXPIRED: 2, MAX_ACCOUNTS: 3, STATUS: 4, COUNTRY: 5, NOTE: 6,
+}
+
 // =================================================================================================
 // 🟢 ĐỊNH NGHĨA TRẠNG THÁI (STATUS)
 // =================================================================================================
@@ -169,6 +213,8 @@ var STATUS_READ = struct {
 	WAIT_REG    string
 	REGISTER    string
 	COMPLETED   string
+	BANNED      string
+	VERIFY      string
 }{
 	RUNNING:     "đang chạy",
 	WAITING:     "đang chờ",
@@ -177,6 +223,8 @@ var STATUS_READ = struct {
 	WAIT_REG:    "chờ đăng ký",
 	REGISTER:    "đăng ký",
 	COMPLETED:   "hoàn thành",
+	BANNED:      "bị khóa",
+	VERIFY:      "cần xác minh",
 }
 
 // Trạng thái dùng để GHI (Hiển thị đẹp trên Excel - Viết hoa)
@@ -186,10 +234,233 @@ var STATUS_WRITE = struct {
 	REGISTERING string
 	WAIT_REG    string
 	ATTENTION   string
+	COMPLETED   string
+	BANNED      string
+	VERIFY      string
+	LOGIN       string
+	REGISTER    string
 }{
 	RUNNING:     "Đang chạy",
 	WAITING:     "Đang chờ",
 	REGISTERING: "Đang đăng ký",
 	WAIT_REG:    "Chờ đăng ký",
 	ATTENTION:   "Chú ý", // Dùng khi nick lỗi
+	COMPLETED:   "Hoàn thành",
+	BANNED:      "Bị khóa",
+	VERIFY:      "Cần xác minh",
+	LOGIN:       "Đăng nhập", // Trả về kho chung
+	REGISTER:    "Đăng ký",
+}
+
+// =================================================================================================
+// 🟢 PHỄU ƯU TIÊN MẶC ĐỊNH (/tool/login)
+// =================================================================================================
+// Mỗi action = 1 danh sách bước theo thứ tự. Owner: "mine" (Nick của Device) | "unassigned" (Kho chung) | "any".
+// Tenant có thể ghi đè / thêm action mới qua node "funnels" trong Token Firebase (Xem service_funnel.go).
+
+var DEFAULT_FUNNELS = map[string]Funnel{
+	"login": {Quality: "login", CheckCompleted: true, Steps: []FunnelStep{
+		{Status: STATUS_READ.RUNNING, Owner: "mine", PrioID: 1}, {Status: STATUS_READ.WAITING, Owner: "mine", PrioID: 2},
+		{Status: STATUS_READ.LOGIN, Owner: "mine", PrioID: 3}, {Status: STATUS_READ.LOGIN, Owner: "unassigned", PrioID: 4},
+	}},
+	"login_reset": {Quality: "login", CheckCompleted: true, Steps: []FunnelStep{
+		{Status: STATUS_READ.RUNNING, Owner: "mine", PrioID: 1}, {Status: STATUS_READ.WAITING, Owner: "mine", PrioID: 2},
+		{Status: STATUS_READ.LOGIN, Owner: "mine", PrioID: 3}, {Status: STATUS_READ.LOGIN, Owner: "unassigned", PrioID: 4},
+		{Status: STATUS_READ.COMPLETED, Owner: "mine", PrioID: 5, Reset: true},
+	}},
+	"register": {Quality: "register", CheckCompleted: true, Steps: []FunnelStep{
+		{Status: STATUS_READ.REGISTERING, Owner: "mine", PrioID: 1}, {Status: STATUS_READ.WAIT_REG, Owner: "mine", PrioID: 2},
+		{Status: STATUS_READ.REGISTER, Owner: "mine", PrioID: 3}, {Status: STATUS_READ.REGISTER, Owner: "unassigned", PrioID: 4},
+	}},
+	"auto": {Quality: "auto", CheckCompleted: true, Steps: []FunnelStep{
+		{Status: STATUS_READ.RUNNING, Owner: "mine", PrioID: 1}, {Status: STATUS_READ.WAITING, Owner: "mine", PrioID: 2},
+		{Status: STATUS_READ.LOGIN, Owner: "mine", PrioID: 3}, {Status: STATUS_READ.LOGIN, Owner: "unassigned", PrioID: 4},
+		{Status: STATUS_READ.REGISTERING, Owner: "mine", PrioID: 5}, {Status: STATUS_READ.WAIT_REG, Owner: "mine", PrioID: 6},
+		{Status: STATUS_READ.REGISTER, Owner: "mine", PrioID: 7}, {Status: STATUS_READ.REGISTER, Owner: "unassigned", PrioID: 8},
+	}},
+	"auto_reset": {Quality: "auto", CheckCompleted: true, Steps: []FunnelStep{
+		{Status: STATUS_READ.RUNNING, Owner: "mine", PrioID: 1}, {Status: STATUS_READ.WAITING, Owner: "mine", PrioID: 2},
+		{Status: STATUS_READ.LOGIN, Owner: "mine", PrioID: 3}, {Status: STATUS_READ.LOGIN, Owner: "unassigned", PrioID: 4},
+		{Status: STATUS_READ.COMPLETED, Owner: "mine", PrioID: 99, Reset: true},
+		{Status: STATUS_READ.REGISTERING, Owner: "mine", PrioID: 5}, {Status: STATUS_READ.WAIT_REG, Owner: "mine", PrioID: 6},
+		{Status: STATUS_READ.REGISTER, Owner: "mine", PrioID: 7}, {Status: STATUS_READ.REGISTER, Owner: "unassigned", PrioID: 8},
+	}},
+}
+
+// =================================================================================================
+// 🟢 CẤU HÌNH XOAY VÒNG NICK (ROTATION)
+// =================================================================================================
+
+var ROTATION = struct {
+	DEFAULT_MODE         string // "sequential" | "round_robin" | "lru" | "random"
+	DEFAULT_COOLDOWN_MIN int    // Số phút nghỉ tối thiểu giữa 2 lần chạy (0 = Tắt)
+}{
+	DEFAULT_MODE:         "sequential", // Giữ hành vi cũ
+	DEFAULT_COOLDOWN_MIN: 0,
+}
+
+// =================================================================================================
+// 🟢 CẤU HÌNH SLOT THIẾT BỊ (NHIỀU NICK / 1 MÁY)
+// =================================================================================================
+
+var DEVICE_SLOTS = struct {
+	DEFAULT_MAX int    // Số Slot tối đa mỗi thiết bị (Token "device_slots" ghi đè)
+	SEPARATOR   string // Ký tự nối DeviceId và Slot trong cột DeviceId
+}{
+	DEFAULT_MAX: 1,   // 1 nick / máy (Như cũ)
+	SEPARATOR:   "#", // "device#2"
+}
+
+// =================================================================================================
+// 🟢 CẤU HÌNH SỔ THIẾT BỊ (DEVICE REGISTRY)
+// =================================================================================================
+
+var DEVICES = struct {
+	SAVE_MS        int64 // Chu kỳ ghi Sổ thiết bị xuống đĩa
+	MAX_PER_TENANT int   // Số thiết bị tối đa mỗi Tenant (Chặn deviceId rác làm phình Sổ)
+}{
+	SAVE_MS:        10000, // 10 giây
+	MAX_PER_TENANT: 5000,  // 5.000 máy
+}
+
+// =================================================================================================
+// 🟢 CẤU HÌNH KHO PROXY (PROXY POOL)
+// =================================================================================================
+
+var PROXY_POOL = struct {
+	DEFAULT_MAX_ACCOUNTS int      // Số nick tối đa / Proxy khi cột MAX_ACCOUNTS trống (Token "proxy_pool.max_accounts" ghi đè)
+	DEFAULT_TYPE         string   // Loại Proxy khi không ghi rõ
+	DISABLED_STATUSES    []string // Trạng thái (Cột STATUS, lowercase) coi như Proxy không dùng được
+}{
+	DEFAULT_MAX_ACCOUNTS: 3,
+	DEFAULT_TYPE:         "http",
+	DISABLED_STATUSES:    []string{"tắt", "lỗi", "die", "off"},
+}
+
+var PROXY_WATCH = struct {
+	CHECK_MS            int64 // Chu kỳ quét PROXY_EXPIRED
+	FLAG_WINDOW_MS      int64 // Proxy hết hạn trong khoảng này -> Đánh dấu, không cấp nick
+	REPORT_WINDOW_HOURS int   // Khoảng mặc định của /tool/proxy-report
+}{
+	CHECK_MS:            60000,   // 1 phút
+	FLAG_WINDOW_MS:      3600000, // 1 giờ
+	REPORT_WINDOW_HOURS: 72,      // 3 ngày
+}
+
+// =================================================================================================
+// 🟢 CẤU HÌNH MÃ 2FA (TOTP)
+// =================================================================================================
+
+var TOTP = struct {
+	DEFAULT_DIGITS int // Số chữ số mặc định (Google Authenticator = 6)
+	DEFAULT_PERIOD int // Chu kỳ mặc định (Giây)
+	MIN_DIGITS     int
+	MAX_DIGITS     int
+}{
+	DEFAULT_DIGITS: 6,
+	DEFAULT_PERIOD: 30,
+	MIN_DIGITS:     6,
+	MAX_DIGITS:     8,
+}
+
+// =================================================================================================
+// 🟢 CẤU HÌNH MÃ HÓA CỘT NHẠY CẢM (ENCRYPTION)
+// =================================================================================================
+// Bật khi có Env DATA_MASTER_KEY (32 byte, Base64 / Hex). Sai định dạng -> Dừng Server ngay lúc khởi động.
+
+var ENCRYPTION = struct {
+	PREFIX     string // Tiền tố ô đã mã hóa: "enc:v<Phiên bản khóa>:<Base64>"
+	KEY_NODE   string // Node Firebase chứa chuỗi khóa dữ liệu (Đã bọc) của từng Tenant
+	BATCH_ROWS int    // Số dòng mã hóa mỗi lô (Mỗi lô giữ SheetMutex 1 lần, 1 lần ghi WAL)
+	COLUMNS    []int  // Các cột DataTiktok được mã hóa
+}{
+	PREFIX:     "enc:v",
+	KEY_NODE:   "DATA_KEYS",
+	BATCH_ROWS: 500,
+	COLUMNS: []int{
+		INDEX_DATA_TIKTOK.PASSWORD, INDEX_DATA_TIKTOK.PASSWORD_EMAIL, INDEX_DATA_TIKTOK.TWO_FA,
+		INDEX_DATA_TIKTOK.REFRESH_TOKEN, INDEX_DATA_TIKTOK.ACCESS_TOKEN, INDEX_DATA_TIKTOK.COOKIE,
+	},
+}
+
+// =================================================================================================
+// 🟢 CẤU HÌNH QUYỀN TOKEN (SCOPES)
+// =================================================================================================
+// Token Firebase có trường "scopes": ["read:auth", "read:activity", "write:status", ...] hoặc "admin".
+// Quyền cột: "read:<nhóm>" / "write:<nhóm>" với nhóm trong COLUMN_GROUPS (Chỉ áp cho DataTiktok).
+
+var SCOPES = struct {
+	ADMIN         string            // Toàn quyền (Mọi cột, mọi Sheet, API quản trị)
+	DEFAULT       []string          // Token cấp qua /tool/tokens không chỉ định "scopes" -> Quyền tối thiểu của Tool
+	LEGACY        []string          // Token không có trường "scopes" (Token cũ tạo tay) -> Giữ toàn quyền như trước
+	MASK          string            // Giá trị thay cho ô không có quyền đọc
+	COLUMN_GROUPS map[string][2]int // Nhóm -> [Cột đầu, Cột cuối] (Tính cả 2 đầu)
+}{
+	ADMIN:   "admin",
+	DEFAULT: []string{"read:status", "read:activity", "write:status"}, // "admin" phải cấp rõ ràng
+	LEGACY:  []string{"admin"},
+	MASK:    "***",
+	COLUMN_GROUPS: map[string][2]int{
+		"status":   {INDEX_DATA_TIKTOK.STATUS, INDEX_DATA_TIKTOK.DEVICE_ID},          // Status, Note, DeviceId
+		"auth":     {INDEX_DATA_TIKTOK.USER_ID, INDEX_DATA_TIKTOK.CREATE_TIME},       // = AuthProfile (Trừ 3 cột trên)
+		"activity": {INDEX_DATA_TIKTOK.STATUS_POST, INDEX_DATA_TIKTOK.COMMISSION_RATE}, // = ActivityProfile
+		"ai":       {INDEX_DATA_TIKTOK.SIGNATURE, INDEX_DATA_TIKTOK.COUNTRY},         // = AiProfile
+	},
+}
+
+// =================================================================================================
+// 🟢 CẤU HÌNH THUÊ NICK (LEASE)
+// =================================================================================================
+
+// Chỉ áp dụng cho Tenant bật "lease" trong node Token (Xem service_lease.go)
+var LEASE = struct {
+	TTL_MS     int64 // Thời hạn thuê nick mặc định, Tool phải Heartbeat trước mốc này
+	MIN_TTL_MS int64 // "ttl_ms" của Tenant nhỏ hơn mốc này -> Dùng TTL_MS
+	REAP_MS    int64 // Chu kỳ Reaper quét & thu hồi nick quá hạn
+}{
+	TTL_MS:     600000, // 10 phút
+	MIN_TTL_MS: 60000,  // 1 phút
+	REAP_MS:    30000,  // 30 giây
+}
+
+// =================================================================================================
+// 🟢 CẤU HÌNH RESET HẰNG NGÀY (TODAY_* COUNT)
+// =================================================================================================
+
+var DAILY_RESET = struct {
+	CHECK_MS       int64 // Chu kỳ kiểm tra sang ngày mới
+	DEFAULT_OFFSET int   // Múi giờ mặc định (Giây so với UTC) khi Token không có "timezone"
+	BATCH_ROWS     int   // Số dòng xử lý mỗi lô (Mỗi lô giữ SheetMutex 1 lần)
+	BATCH_PAUSE_MS int64 // Nghỉ giữa các lô
+}{
+	CHECK_MS:       60000,    // 1 phút
+	DEFAULT_OFFSET: 7 * 3600, // UTC+7 (Giờ VN)
+	BATCH_ROWS:     500,      // 500 dòng
+	BATCH_PAUSE_MS: 200,      // 0.2 giây
+}
+
+// =================================================================================================
+// 🟢 CẤU HÌNH BACKEND SQL (SQLITE / POSTGRES)
+// =================================================================================================
+// Dùng khi STORE_BACKEND=sqlite hoặc STORE_BACKEND=postgres.
+// Mỗi spreadsheetId (Tenant) được tách riêng: SQLite -> 1 file DB, Postgres -> 1 Schema.
+
+var SQL_STORE = struct {
+	MAX_ROW       int    // Giới hạn số dòng đọc từ SQL (Thay cho RANGES.DATA_MAX_ROW của Google)
+	SQLITE_DIR    string // Thư mục chứa file SQLite mặc định (Env SQLITE_DIR ghi đè)
+	SCHEMA_PREFIX string // Tiền tố tên Schema Postgres cho từng Tenant
+	MAX_COLS      int    // Số cột tối đa mỗi bảng (Postgres giới hạn 1600, SQLite 2000)
+}{
+	MAX_ROW:       200000, // 200.000 dòng
+	SQLITE_DIR:    "./data",
+	SCHEMA_PREFIX: "tenant_",
+	MAX_COLS:      1000,
+}
+
+// Bảng SQL tương ứng với từng Sheet (Sheet khác sẽ tự chuẩn hóa tên)
+var SQL_TABLES = map[string]string{
+	"DataTiktok":  "data_tiktok",
+	"EmailLogger": "email_logger",
+	"PostLogger":  "post_logger",
+	"Proxy":       "proxy",
 }
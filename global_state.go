@@ -21,6 +21,16 @@ var STATE = struct {
 
 	QueueMutex sync.Mutex
 	WriteQueue map[string]*WriteQueueData
+
+	// Bộ đếm Janitor (sync/atomic) -> Xem qua /tool/stats để phát hiện spam Token rác
+	Stats struct {
+		TokenSweeps    int64 // Số lần Janitor chạy
+		TokenExpired   int64 // Token hết hạn bị Janitor dọn
+		TokenEvicted   int64 // Token bị đá ra do vượt CACHE.TOKEN_MAX_KEYS
+		TokenNegatives int64 // Token sai được ghi vào Negative Cache
+		RateExpired    int64 // Bản ghi Rate Limit nhàn rỗi bị dọn
+		RateEvicted    int64 // Bản ghi Rate Limit bị đá ra do vượt TOKEN_RULES.RATE_MAX_KEYS
+	}
 }{
 	TokenCache: make(map[string]*CachedToken),
 	RateLimit:  make(map[string]*RateLimitData),
@@ -59,18 +69,35 @@ type RateLimitData struct {
 type SheetCacheData struct {
 	RawValues      [][]interface{}  // Dữ liệu gốc
 	CleanValues    [][]string       // Dữ liệu string (lowercase)
-	AssignedMap    map[string]int   // Key: DeviceID -> Value: RowIndex (Truy cập O(1))
+	AssignedMap    map[string][]int // Key: DeviceID gốc (Bỏ Slot) -> Mọi RowIndex của thiết bị
 	UnassignedList []int            // List Index của nick trống (DeviceId == "")
 	StatusMap      map[string][]int // Key: Status -> List RowIndex
-	LastAccessed   int64
+	BaseValues     [][]interface{} // Bản chụp trạng thái trên Store (Gốc để hợp nhất 3 chiều khi có chỉnh sửa tay)
+	BaseGen        int64           // Tăng mỗi lần Flush cập nhật BaseValues (Bản Fresh đọc trước mốc này đã cũ)
+	StoreVersion   string          // Phiên bản Store (VersionProber) ở lần đọc đầy đủ gần nhất
+	FullCheckAt    int64           // Mốc (ms) đọc đầy đủ gần nhất của Watcher
+	LastAccessed   int64 // Đọc/ghi bằng sync/atomic (Cập nhật cả khi chỉ giữ RLock)
+	SizeBytes      int64 // Ước lượng dung lượng RAM (Dùng cho giới hạn CACHE.SHEET_MAX_BYTES)
 	Timestamp      int64
 	TTL            int64
 }
 
+// RowCells: Các ô bị thay đổi trong 1 dòng (Col -> Giá trị mới)
+type RowCells map[int]interface{}
+
 // Queue chung cho Data và Mail
 type WriteQueueData struct {
 	Timer      bool
 	IsFlushing bool
-	Updates    map[string]map[int][]interface{} // Sheet -> Row -> Data
+	Updates    map[string]map[int]RowCells      // Sheet -> Row -> Các ô bẩn (Chỉ ghi đúng ô đã đổi)
 	Appends    map[string][][]interface{}       // Sheet -> Rows
+	AppendSeqs map[string][]int64               // Sheet -> Số thứ tự WAL của từng dòng Append (Song song với Appends)
+	Attempts   map[string]int                   // "update:Sheet" / "append:Sheet" -> Số lần ghi lỗi liên tiếp
+	RetryAt    int64                            // Mốc thời gian (ms) được phép thử lại (Backoff)
+
+	LastSeq      int64                          // Số thứ tự dòng Append cấp gần nhất
+	Applied      map[string]int64               // Sheet -> Seq lớn nhất đã Append thành công (Replay bỏ qua dòng <= mốc này)
+	FlushUpdates map[string]map[int]RowCells    // Bản đang Flush (Vẫn phải nằm trong WAL khi nén giữa chừng)
+	FlushAppends map[string][][]interface{}
+	FlushSeqs    map[string][]int64
 }
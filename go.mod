@@ -4,6 +4,8 @@ go 1.23
 
 require (
 	firebase.google.com/go/v4 v4.13.0
+	github.com/lib/pq v1.10.9
 	google.golang.org/api v0.169.0
 	golang.org/x/text v0.14.0
+	modernc.org/sqlite v1.29.5
 )
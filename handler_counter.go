@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+/*
+=================================================================================================
+📘 TÀI LIỆU API: CỘNG BỘ ĐẾM HOẠT ĐỘNG (POST /tool/counter)
+=================================================================================================
+
+1. MỤC ĐÍCH:
+   - Tool báo đã đăng bài / follow xong -> Server cộng TODAY_*_COUNT ngay trong RAM (Atomic).
+   - Vượt DAILY_*_LIMIT -> Từ chối (Không cộng) để Tool dừng hoạt động đó.
+
+2. CẤU TRÚC BODY REQUEST:
+{
+  "token": "...",
+  "deviceId": "...",          // (Tùy chọn) Có thì kiểm tra nick thuộc Device này
+  "row_index": 123,
+  "activity": "post",         // "post" | "follow"
+  "amount": 1                 // (Tùy chọn) Mặc định 1
+}
+
+3. RESPONSE:
+   - { "status": "true", "count": 3, "limit": 5, "remaining": 2 }   // remaining = -1 nếu không giới hạn
+*/
+
+func HandleCounter(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"status":"false","messenger":"JSON Error"}`, 400); return
+	}
+
+	tokenData, ok := r.Context().Value("tokenData").(*TokenData)
+	if !ok {
+		http.Error(w, `{"status":"false","messenger":"Lỗi xác thực"}`, 401)
+		return
+	}
+
+	rowIdx := -1
+	if v, ok := body["row_index"]; ok {
+		if val, ok := toFloat(v); ok { rowIdx = int(val) - RANGES.DATA_START_ROW }
+	}
+	amount := 1
+	if v, ok := toFloat(body["amount"]); ok { amount = int(v) }
+
+	res, err := IncrementQuota(tokenData.SpreadsheetID, rowIdx, CleanString(body["deviceId"]), CleanString(body["activity"]), amount)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
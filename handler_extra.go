@@ -2,8 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // --- Handler Tạo Sheet (Stub hoạt động) ---
@@ -43,3 +45,226 @@ func HandleClearCache(w http.ResponseWriter, r *http.Request) {
 		"deleted_keys": count,
 	})
 }
+
+// --- Handler Dead-letter (Batch ghi thất bại) ---
+// Body: { "token": "...", "action": "list" | "replay" | "discard", "ids": ["..."] }
+// ids rỗng = Áp dụng cho tất cả Entry của spreadsheetId này.
+func HandleDeadLetter(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"status":"false","messenger":"JSON Error"}`, 400); return
+	}
+	tokenData, ok := r.Context().Value("tokenData").(*TokenData)
+	if !ok {
+		http.Error(w, `{"status":"false","messenger":"Lỗi xác thực"}`, 401)
+		return
+	}
+	sid := tokenData.SpreadsheetID
+
+	var ids []string
+	if arr, ok := body["ids"].([]interface{}); ok {
+		for _, v := range arr { if id := SafeString(v); id != "" { ids = append(ids, id) } }
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch CleanString(body["action"]) {
+	case "", "list":
+		list := ListDeadLetters(sid)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": "Thành công", "count": len(list), "data": list})
+	case "replay":
+		n, err := ReplayDeadLetters(sid, ids)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": "false", "messenger": fmt.Sprintf("Lỗi ghi nhật ký (WAL) sau %d batch, phần còn lại vẫn trong Dead-letter", n), "count": n})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": fmt.Sprintf("Đã đưa %d batch vào hàng đợi", n), "count": n})
+	case "discard":
+		n := len(TakeDeadLetters(sid, ids))
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": fmt.Sprintf("Đã xóa %d batch", n), "count": n})
+	default:
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Action không hợp lệ"})
+	}
+}
+
+// --- Handler Thống kê (Janitor Token / Rate Limit) ---
+func HandleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "true", "messenger": "Thành công", "auth": AuthCacheStats(),
+	})
+}
+
+// --- Handler Sổ thiết bị ---
+// Body: { "token": "...", "action": "list" | "set_group" | "delete" | "set_group_filter", ... }
+// - list            : { "group": "..." } (Tùy chọn) -> Danh sách thiết bị + nick đang giữ
+// - set_group       : { "ids": ["dev1"], "group": "A", "tags": ["kho-1"] }
+// - delete          : { "ids": ["dev1"] }
+// - set_group_filter: { "group": "A", "search_and": {...}, "search_or": {...} } (Không có filter = Xóa)
+func HandleDevices(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"status":"false","messenger":"JSON Error"}`, 400); return
+	}
+	tokenData, ok := r.Context().Value("tokenData").(*TokenData)
+	if !ok {
+		http.Error(w, `{"status":"false","messenger":"Lỗi xác thực"}`, 401)
+		return
+	}
+	sid := tokenData.SpreadsheetID
+
+	var ids []string
+	if arr, ok := body["ids"].([]interface{}); ok {
+		for _, v := range arr { if id := SafeString(v); id != "" { ids = append(ids, id) } }
+	}
+	group := SafeString(body["group"])
+
+	w.Header().Set("Content-Type", "application/json")
+	switch CleanString(body["action"]) {
+	case "", "list":
+		list := ListDevices(sid, group)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": "Thành công", "count": len(list), "data": list})
+	case "set_group":
+		var tags []string
+		if arr, ok := body["tags"].([]interface{}); ok {
+			tags = []string{}
+			for _, v := range arr { if t := SafeString(v); t != "" { tags = append(tags, t) } }
+		}
+		n := SetDeviceGroup(sid, ids, group, tags)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": fmt.Sprintf("Đã cập nhật %d thiết bị", n), "count": n})
+	case "delete":
+		n := DeleteDevices(sid, ids)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": fmt.Sprintf("Đã xóa %d thiết bị", n), "count": n})
+	case "set_group_filter":
+		var rule *DeviceGroup
+		and, _ := body["search_and"].(map[string]interface{})
+		or, _ := body["search_or"].(map[string]interface{})
+		if len(and) > 0 || len(or) > 0 { rule = &DeviceGroup{SearchAnd: and, SearchOr: or} }
+		if err := SetGroupFilter(sid, group, rule); err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "true", "messenger": "Đã lưu bộ lọc nhóm"})
+	default:
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Action không hợp lệ"})
+	}
+}
+
+// --- Handler Báo cáo hạn Proxy ---
+// Body: { "token": "...", "within_hours": 72 } -> Nick & Proxy trong kho hết hạn trong 72 giờ tới (Kể cả đã hết hạn)
+func HandleProxyReport(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"status":"false","messenger":"JSON Error"}`, 400); return
+	}
+	tokenData, ok := r.Context().Value("tokenData").(*TokenData)
+	if !ok {
+		http.Error(w, `{"status":"false","messenger":"Lỗi xác thực"}`, 401)
+		return
+	}
+
+	hours := float64(PROXY_WATCH.REPORT_WINDOW_HOURS)
+	if v, ok := toFloat(body["within_hours"]); ok && v >= 0 { hours = v }
+
+	w.Header().Set("Content-Type", "application/json")
+	accounts, proxies, err := ProxyExpiryReport(tokenData.SpreadsheetID, time.Duration(hours*float64(time.Hour)))
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "true", "messenger": "Thành công", "within_hours": hours,
+		"count": len(accounts), "accounts": accounts, "proxies": proxies,
+	})
+}
+
+// --- Handler Mã hóa cột nhạy cảm ---
+// Body: { "token": "...", "action": "status" | "rotate" | "seal" }
+// - status: Phiên bản khóa & số ô theo phiên bản (0 = Chưa mã hóa)
+// - rotate: Tạo khóa dữ liệu mới & mã hóa lại toàn bộ DataTiktok qua Write Queue
+// - seal  : Mã hóa ngay các ô nhạy cảm còn dạng rõ
+func HandleEncryption(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"status":"false","messenger":"JSON Error"}`, 400); return
+	}
+	tokenData, ok := r.Context().Value("tokenData").(*TokenData)
+	if !ok {
+		http.Error(w, `{"status":"false","messenger":"Lỗi xác thực"}`, 401)
+		return
+	}
+	sid := tokenData.SpreadsheetID
+
+	w.Header().Set("Content-Type", "application/json")
+	switch CleanString(body["action"]) {
+	case "", "status":
+		st, err := EncryptionStatus(sid)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": "Thành công", "data": st})
+	case "rotate":
+		ver, n, err := RotateTenantKey(sid)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": fmt.Sprintf("Đã xoay sang khóa v%d, mã hóa lại %d dòng", ver, n), "version": ver, "count": n})
+	case "seal":
+		if !cryptoEnabled() {
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Chưa cấu hình DATA_MASTER_KEY"})
+			return
+		}
+		cache, err := LayDuLieu(sid, SHEET_NAMES.DATA_TIKTOK, false)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Lỗi tải dữ liệu"})
+			return
+		}
+		n := sealSheet(sid, cache)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": fmt.Sprintf("Đã mã hóa %d dòng", n), "count": n})
+	default:
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Action không hợp lệ"})
+	}
+}
+
+// --- Handler Quản lý Token ---
+// Header: X-Admin-Key: <TOKEN_ADMIN_KEY> (Khóa vận hành, KHÔNG dùng Token Tenant - xem OperatorMiddleware)
+// Body: { "spreadsheetId": "...", "action": "list" | "issue" | "extend" | "revoke", "target_token": "...", ... }
+// - issue : { "days": 30 } hoặc { "expired": "31/12/2026 23:59:59" }, (Tùy chọn) "scopes", "note", "data": { TOKEN_RULES.DATA_KEYS }
+// - extend: { "target_token": "...", "days": 30 | "expired": "..." } -> Cộng từ hạn cũ (Nếu còn hạn) & mở block.
+//           Hạn mới không quá TOKEN_RULES.MAX_DAYS ngày kể từ hôm nay.
+// - revoke: { "target_token": "..." } -> blocked = true, xóa Cache ngay
+// - Chỉ thao tác trên Token cùng spreadsheetId
+func HandleTokens(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"status":"false","messenger":"JSON Error"}`, 400); return
+	}
+	sid := CleanString(body["spreadsheetId"])
+	target := SafeString(body["target_token"])
+
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(err error) {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+	}
+	if sid == "" { fail(fmt.Errorf("Thiếu spreadsheetId")); return }
+	switch CleanString(body["action"]) {
+	case "", "list":
+		list, err := ListTokens(sid)
+		if err != nil { fail(err); return }
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": "Thành công", "count": len(list), "data": list})
+	case "issue":
+		token, rec, err := IssueToken(sid, body)
+		if err != nil { fail(err); return }
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": "Đã cấp Token", "new_token": token, "data": rec})
+	case "extend":
+		exp, err := ExtendToken(sid, target, body)
+		if err != nil { fail(err); return }
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "true", "messenger": "Đã gia hạn đến " + exp, "expired": exp})
+	case "revoke":
+		if err := RevokeToken(sid, target); err != nil { fail(err); return }
+		json.NewEncoder(w).Encode(map[string]string{"status": "true", "messenger": "Đã thu hồi Token"})
+	default:
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Action không hợp lệ"})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+/*
+=================================================================================================
+📘 TÀI LIỆU API: GIA HẠN THUÊ NICK (POST /tool/heartbeat)
+=================================================================================================
+
+1. MỤC ĐÍCH:
+   - Báo cho Server biết Device vẫn sống -> Gia hạn Lease các nick đang giữ thêm 1 TTL.
+   - Chỉ dùng khi Tenant bật "lease" trong node Token. /tool/updated & /tool/log cũng gia hạn.
+   - Không gọi kịp -> Reaper trả nick về "Đang chờ" và gỡ DeviceId.
+
+2. CẤU TRÚC BODY REQUEST:
+{
+  "token": "...",
+  "deviceId": "...",
+  "slot": 2,                  // (Tùy chọn) Chỉ gia hạn Slot này (Kể cả 1). Bỏ trống = Mọi Slot
+  "row_index": 123            // (Tùy chọn) Chỉ gia hạn dòng này. Bỏ trống = Tất cả nick của Device
+}
+
+3. RESPONSE:
+   - { "status": "true", "rows": [123], "lease_expires_at": 1700000000000 }
+   - status "false" = Device không còn giữ nick -> Tool nên gọi lại /tool/login.
+*/
+
+func HandleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"status":"false","messenger":"JSON Error"}`, 400); return
+	}
+
+	tokenData, ok := r.Context().Value("tokenData").(*TokenData)
+	if !ok { return }
+
+	w.Header().Set("Content-Type", "application/json")
+	deviceId := CleanString(body["deviceId"])
+	if deviceId == "" {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Thiếu deviceId"})
+		return
+	}
+
+	rowIdx := -1
+	if v, ok := body["row_index"]; ok {
+		if val, ok := toFloat(v); ok { rowIdx = int(val) - RANGES.DATA_START_ROW }
+	}
+
+	slot, err := resolveSlot(tokenData, body)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
+
+	rows, exp, err := HeartbeatLeases(tokenData.SpreadsheetID, deviceKey(deviceId, slot), CleanString(body["slot"]) != "", rowIdx)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "true", "messenger": "Đã gia hạn", "rows": rows, "lease_expires_at": exp,
+	})
+}
@@ -21,6 +21,8 @@ func HandleLogData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	touchLeases(tokenData.SpreadsheetID, CleanString(body["deviceId"])) // Tool còn ghi log = Còn sống -> Gia hạn nick đang giữ
+
 	dataList, _ := body["data"].([]interface{})
 	if len(dataList) == 0 {
 		json.NewEncoder(w).Encode(map[string]string{"status": "true", "messenger": "Không có dữ liệu để ghi"})
@@ -28,6 +30,7 @@ func HandleLogData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rowsBySheet := make(map[string][][]interface{})
+	scopes := tokenScopes(tokenData)
 
 	// Gom nhóm data theo Sheet Name
 	for _, item := range dataList {
@@ -38,6 +41,11 @@ func HandleLogData(w http.ResponseWriter, r *http.Request) {
 		if s, ok := obj["sheet"].(string); ok && s != "" {
 			sheetName = s
 		}
+		// Append thẳng vào DataTiktok = Ghi mọi cột -> Chỉ admin
+		if sheetName == SHEET_NAMES.DATA_TIKTOK && !scopes.Has(SCOPES.ADMIN) {
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Token không có quyền ghi Sheet " + sheetName})
+			return
+		}
 		
 		// Tìm max col index
 		maxCol := 0
@@ -64,8 +72,9 @@ func HandleLogData(w http.ResponseWriter, r *http.Request) {
 
 	// Đẩy vào Queue Append
 	for sheet, rows := range rowsBySheet {
-		if len(rows) > 0 {
-			QueueAppend(tokenData.SpreadsheetID, sheet, rows)
+		if len(rows) > 0 && QueueAppend(tokenData.SpreadsheetID, sheet, rows).Wait() != nil {
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Lỗi ghi nhật ký (WAL), thử lại"})
+			return
 		}
 	}
 	
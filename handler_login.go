@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 )
 
 /*
@@ -24,6 +23,7 @@ import (
   "type": "auto",             // Lệnh: "login", "register", "auto", "auto_reset", "login_reset"
   "token": "...",             // Token xác thực
   "deviceId": "...",          // ID thiết bị
+  "slot": 2,                  // (Tùy chọn) Slot trên thiết bị chạy nhiều nick (Mặc định 1, xem service_slot.go)
   
   // --- TÙY CHỌN 1: LẤY CHÍNH XÁC (Ưu tiên cao nhất) ---
   "row_index": 123,           // Lấy chính xác dòng 123 (nếu thỏa mãn điều kiện)
@@ -34,6 +34,10 @@ import (
       "min_col_29": 1000              // Cột 29 >= 1000
   },
   "search_or": { ... },       // Điều kiện HOẶC (1 trong các điều kiện đúng)
+  "activity": "post",         // (Tùy chọn) "post" | "follow" -> Bỏ qua nick đã hết hạn mức trong ngày
+  "rotation": "lru",          // (Tùy chọn) "sequential" | "round_robin" | "lru" | "random" (Xem service_rotation.go)
+  "cooldown_minutes": 30,     // (Tùy chọn) Bỏ qua nick vừa chạy trong 30 phút
+  "with_totp": true,          // (Tùy chọn) Trả kèm mã 2FA hiện tại & kế tiếp (Xem /tool/2fa)
 
   // --- TÙY CHỌN 3: CẬP NHẬT KHI LẤY ---
   "updated": {
@@ -41,11 +45,21 @@ import (
   }
 }
 
-3. QUY TRÌNH ƯU TIÊN (PRIORITY FUNNEL):
+3. QUY TRÌNH ƯU TIÊN (PRIORITY FUNNEL) - Mặc định (DEFAULT_FUNNELS), Tenant ghi đè được (service_funnel.go):
    - Bước 1: Tìm nick "Đang chạy" (Running) của Device này.
    - Bước 2: Tìm nick "Đang chờ" (Waiting) của Device này.
    - Bước 3: Tìm nick "Đăng nhập" (Login) -> Ưu tiên của mình -> Sau đó đến kho chung (Trống DeviceId).
    - Bước 4: (Nếu là Auto/Reg) Tìm nick "Đang/Chờ/Đăng ký".
+   - Tenant bật "lease": Nick "Đang chờ"/"Chờ đăng ký" không có DeviceId (Bị thu hồi Lease) được coi như kho chung.
+
+4. LEASE (THUÊ CÓ THỜI HẠN):
+   - Tenant bật "lease" (Node Token): Response trả về "lease_expires_at" (Unix ms). Tool gọi POST /tool/heartbeat để gia hạn.
+   - Quá hạn -> Server tự trả nick về "Đang chờ" và gỡ DeviceId (Xem service_lease.go).
+
+5. KHO PROXY (Tenant bật "proxy_pool" trong Token):
+   - Nick chưa có Proxy / Proxy đã hoặc sắp hết hạn -> Tự cấp Proxy rảnh từ Sheet "Proxy" (Xem service_proxy.go).
+   - Không bật kho: Nick có Proxy đã / sắp hết hạn bị bỏ qua (Xem service_proxy_watch.go).
+   - "auth_profile.proxy_detail": { "type", "host", "port", "user", "pass", "expired", "country" }.
 */
 
 type LoginResponse struct {
@@ -55,18 +69,13 @@ type LoginResponse struct {
 	DeviceId        string          `json:"deviceId"`
 	RowIndex        int             `json:"row_index"`
 	SystemEmail     string          `json:"system_email"`
+	LeaseExpiresAt  int64           `json:"lease_expires_at,omitempty"`
+	Totp            *TotpResult     `json:"totp,omitempty"`
 	AuthProfile     AuthProfile     `json:"auth_profile"`
 	ActivityProfile ActivityProfile `json:"activity_profile"`
 	AiProfile       AiProfile       `json:"ai_profile"`
 }
 
-type PriorityStep struct {
-	Status  string
-	IsMy    bool
-	IsEmpty bool
-	PrioID  int
-}
-
 // HANDLER CHÍNH
 func HandleAccountAction(w http.ResponseWriter, r *http.Request) {
 	var body map[string]interface{}
@@ -81,27 +90,58 @@ func HandleAccountAction(w http.ResponseWriter, r *http.Request) {
 	deviceId := CleanString(body["deviceId"])
 	reqType := CleanString(body["type"])
 	
-	action := "login"
-	if reqType == "register" { action = "register" } else if reqType == "auto" { action = "auto" } else if reqType == "auto_reset" { action = "auto_reset" } else if reqType == "login_reset" { action = "login_reset" }
+	w.Header().Set("Content-Type", "application/json")
+	slot, err := resolveSlot(tokenData, body)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
+	devKey := deviceKey(deviceId, slot) // Giá trị cột DeviceId của Slot này
+
+	// Action không có phễu (Tenant / Mặc định) -> Coi như "login"
+	action := reqType
+	funnel, ok := resolveFunnel(tokenData, action)
+	if !ok { action = "login"; funnel, _ = resolveFunnel(tokenData, action) }
+	if activity := CleanString(body["activity"]); activity != "" { funnel.Activity = activity }
+	
+	rotation, err := resolveRotation(tokenData, body)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
 	
 	updateMap := parseUpdateDataLogin(body)
+	scopes := tokenScopes(tokenData)
+	err = checkWritableCols(scopes, updateMap)
+	if err == nil { err = checkFilterCols(scopes, parseFilterParams(body)) }
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
 
-	res, err := xu_ly_lay_du_lieu(sid, deviceId, body, action, updateMap)
+	res, err := xu_ly_lay_du_lieu(sid, devKey, body, action, funnel, rotation, scopes, updateMap)
 
-	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
 		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
 		return
 	}
+	if withTotp, _ := body["with_totp"].(bool); withTotp {
+		res.Totp, _ = GenerateTotp(res.AuthProfile.TwoFa, 0, 0) // Secret lỗi / trống -> Bỏ qua, vẫn trả nick
+	}
 	json.NewEncoder(w).Encode(res)
 }
 
 // LOGIC LÕI
-func xu_ly_lay_du_lieu(sid, deviceId string, body map[string]interface{}, action string, updateMap map[int]interface{}) (*LoginResponse, error) {
+func xu_ly_lay_du_lieu(sid, deviceId string, body map[string]interface{}, action string, funnel Funnel, rotation RotationPolicy, scopes ScopeSet, updateMap map[int]interface{}) (*LoginResponse, error) {
 	cacheData, err := LayDuLieu(sid, SHEET_NAMES.DATA_TIKTOK, false)
 	if err != nil { return nil, fmt.Errorf("Lỗi tải dữ liệu") }
 
 	filters := parseFilterParams(body)
+	groupFilter := deviceGroupFilter(sid, deviceId) // Bộ lọc theo Group của thiết bị (Sổ thiết bị)
+	skipExpiring := !proxyPoolEnabled(sid)          // Có kho Proxy -> Nick sẽ được đổi Proxy thay vì bị bỏ qua
+	if funnel.Activity != "" {
+		if _, _, ok := quotaCols(funnel.Activity); !ok { return nil, fmt.Errorf("Activity không hợp lệ (post | follow)") }
+	}
 	STATE.SheetMutex.RLock()
 	rawLen := len(cacheData.RawValues)
 
@@ -115,30 +155,41 @@ func xu_ly_lay_du_lieu(sid, deviceId string, body map[string]interface{}, action
 						STATE.SheetMutex.RUnlock(); return nil, fmt.Errorf("Row không khớp Filter")
 					}
 				}
-				valQ := KiemTraChatLuongClean(cacheData.CleanValues[idx], action)
+				if funnel.Activity != "" && !hasQuota(sid, cacheData.RawValues[idx], funnel.Activity) {
+					STATE.SheetMutex.RUnlock(); return nil, fmt.Errorf("Nick đã hết hạn mức %s trong ngày", funnel.Activity)
+				}
+				if groupFilter.HasFilter && !isRowMatched(cacheData.CleanValues[idx], cacheData.RawValues[idx], groupFilter) {
+					STATE.SheetMutex.RUnlock(); return nil, fmt.Errorf("Nick không thuộc nhóm của thiết bị")
+				}
+				if skipExpiring && proxyFlagged(sid, idx) {
+					STATE.SheetMutex.RUnlock(); return nil, fmt.Errorf("Proxy của nick đã / sắp hết hạn")
+				}
+				valQ := KiemTraChatLuongClean(cacheData.CleanValues[idx], funnel.Quality)
 				STATE.SheetMutex.RUnlock()
-				return commit_and_response(sid, deviceId, cacheData, idx, determineType(cacheData.CleanValues[idx]), valQ.SystemEmail, action, 0, updateMap)
+				return commit_and_response(sid, deviceId, cacheData, idx, determineType(cacheData.CleanValues[idx]), valQ.SystemEmail, false, scopes, updateMap)
 			}
 			STATE.SheetMutex.RUnlock(); return nil, fmt.Errorf("Row không tồn tại")
 		}
 	}
 
 	// 2. LẤY THEO PHỄU ƯU TIÊN (PRIORITY FUNNEL)
-	steps := buildPrioritySteps(action)
-	for _, step := range steps {
-		indices := cacheData.StatusMap[step.Status]
+	for _, step := range funnel.Steps {
+		indices := orderCandidates(sid, step.Status, cacheData.StatusMap[step.Status], cacheData, rotation)
 		for _, idx := range indices {
 			if idx < rawLen {
 				row := cacheData.CleanValues[idx]
-				isMyDevice := (row[INDEX_DATA_TIKTOK.DEVICE_ID] == deviceId)
-				isEmptyDevice := (row[INDEX_DATA_TIKTOK.DEVICE_ID] == "")
-				
-				if (step.IsMy && isMyDevice) || (step.IsEmpty && isEmptyDevice) {
+				if step.matchOwner(row[INDEX_DATA_TIKTOK.DEVICE_ID], deviceId) {
 					if filters.HasFilter {
 						if !isRowMatched(row, cacheData.RawValues[idx], filters) { continue }
 					}
+					if step.Filters.HasFilter {
+						if !isRowMatched(row, cacheData.RawValues[idx], step.Filters) { continue }
+					}
+					if funnel.Activity != "" && !hasQuota(sid, cacheData.RawValues[idx], funnel.Activity) { continue }
+					if groupFilter.HasFilter && !isRowMatched(row, cacheData.RawValues[idx], groupFilter) { continue }
+					if skipExpiring && proxyFlagged(sid, idx) { continue }
 					
-					val := KiemTraChatLuongClean(row, action)
+					val := KiemTraChatLuongClean(row, funnel.Quality)
 					if !val.Valid {
 						STATE.SheetMutex.RUnlock(); doSelfHealing(sid, idx, val.Missing, cacheData); STATE.SheetMutex.RLock()
 						continue
@@ -146,11 +197,12 @@ func xu_ly_lay_du_lieu(sid, deviceId string, body map[string]interface{}, action
 
 					STATE.SheetMutex.RUnlock(); STATE.SheetMutex.Lock() // Chuyển sang Write Lock
 					currRow := cacheData.CleanValues[idx] // Double Check
-					if (step.IsMy && currRow[INDEX_DATA_TIKTOK.DEVICE_ID] == deviceId) || (step.IsEmpty && currRow[INDEX_DATA_TIKTOK.DEVICE_ID] == "") {
+					if currRow[INDEX_DATA_TIKTOK.STATUS] == step.Status && step.matchOwner(currRow[INDEX_DATA_TIKTOK.DEVICE_ID], deviceId) {
 						// Gán thiết bị tạm thời trong RAM
 						updateRowCache(cacheData, idx, "", "", deviceId)
+						markRotation(sid, step.Status, idx)
 						STATE.SheetMutex.Unlock()
-						return commit_and_response(sid, deviceId, cacheData, idx, determineType(cacheData.CleanValues[idx]), val.SystemEmail, action, step.PrioID, updateMap)
+						return commit_and_response(sid, deviceId, cacheData, idx, determineType(cacheData.CleanValues[idx]), val.SystemEmail, step.Reset, scopes, updateMap)
 					}
 					STATE.SheetMutex.Unlock(); STATE.SheetMutex.RLock()
 				}
@@ -159,13 +211,10 @@ func xu_ly_lay_du_lieu(sid, deviceId string, body map[string]interface{}, action
 	}
 	
 	// 3. CHECK HOÀN THÀNH
-	checkList := []string{"login", "auto", "login_reset", "register"}
-	isCheck := false
-	for _, s := range checkList { if strings.Contains(action, s) { isCheck = true; break } }
-	if isCheck {
+	if funnel.CheckCompleted {
 		completedIndices := cacheData.StatusMap[STATUS_READ.COMPLETED]
 		for _, idx := range completedIndices {
-			if idx < rawLen && cacheData.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID] == deviceId {
+			if idx < rawLen && sameDevice(cacheData.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID], deviceId) {
 				STATE.SheetMutex.RUnlock(); return nil, fmt.Errorf("Các tài khoản đã hoàn thành")
 			}
 		}
@@ -176,29 +225,7 @@ func xu_ly_lay_du_lieu(sid, deviceId string, body map[string]interface{}, action
 }
 
 // CÁC HÀM HỖ TRỢ
-func buildPrioritySteps(action string) []PriorityStep {
-	steps := make([]PriorityStep, 0, 10)
-	add := func(st string, my, empty bool, prio int) {
-		steps = append(steps, PriorityStep{Status: st, IsMy: my, IsEmpty: empty, PrioID: prio})
-	}
-	if action == "login" || action == "login_reset" {
-		add(STATUS_READ.RUNNING, true, false, 1); add(STATUS_READ.WAITING, true, false, 2)
-		add(STATUS_READ.LOGIN, true, false, 3); add(STATUS_READ.LOGIN, false, true, 4)
-		if action == "login_reset" { add(STATUS_READ.COMPLETED, true, false, 5) }
-	} else if action == "register" {
-		add(STATUS_READ.REGISTERING, true, false, 1); add(STATUS_READ.WAIT_REG, true, false, 2)
-		add(STATUS_READ.REGISTER, true, false, 3); add(STATUS_READ.REGISTER, false, true, 4)
-	} else if action == "auto" || action == "auto_reset" {
-		add(STATUS_READ.RUNNING, true, false, 1); add(STATUS_READ.WAITING, true, false, 2)
-		add(STATUS_READ.LOGIN, true, false, 3); add(STATUS_READ.LOGIN, false, true, 4)
-		if action == "auto_reset" { add(STATUS_READ.COMPLETED, true, false, 99) }
-		add(STATUS_READ.REGISTERING, true, false, 5); add(STATUS_READ.WAIT_REG, true, false, 6)
-		add(STATUS_READ.REGISTER, true, false, 7); add(STATUS_READ.REGISTER, false, true, 8)
-	}
-	return steps
-}
-
-func commit_and_response(sid, deviceId string, cache *SheetCacheData, idx int, typ, email, action string, priority int, updateMap map[int]interface{}) (*LoginResponse, error) {
+func commit_and_response(sid, deviceId string, cache *SheetCacheData, idx int, typ, email string, isReset bool, scopes ScopeSet, updateMap map[int]interface{}) (*LoginResponse, error) {
 	row := cache.RawValues[idx]
 	tSt := STATUS_WRITE.RUNNING
 	if typ == "register" { tSt = STATUS_WRITE.REGISTERING }
@@ -206,13 +233,14 @@ func commit_and_response(sid, deviceId string, cache *SheetCacheData, idx int, t
 	oldNote := SafeString(row[INDEX_DATA_TIKTOK.NOTE])
 	mode := "normal"
 	isResetCompleted := false
-	if (strings.Contains(action, "reset")) && (priority == 5 || priority == 99) {
+	if isReset {
 		mode = "reset"; isResetCompleted = true
 	}
 	tNote := tao_ghi_chu_chuan_login(oldNote, tSt, mode)
+	proxyPool, proxySetting := loadProxyPool(sid) // nil nếu Tenant không bật kho Proxy
 
 	STATE.SheetMutex.Lock()
-	defer STATE.SheetMutex.Unlock()
+	var tickets []journalTicket // fsync WAL sau khi nhả SheetMutex (Không bắt Tenant khác chờ đĩa)
 
 	// Dọn dẹp nick cũ
 	cleanupIndices := getCleanupIndices(cache, deviceId, idx, isResetCompleted)
@@ -223,39 +251,52 @@ func commit_and_response(sid, deviceId string, cache *SheetCacheData, idx int, t
 		cNote := tao_ghi_chu_chuan_login(cOldNote, cSt, "normal")
 		if isResetCompleted { cNote = tao_ghi_chu_chuan_login(cOldNote, "Reset chờ chạy", "reset") }
 		
-		updateRowCache(cache, cIdx, cSt, cNote, "")
-		cRow := make([]interface{}, len(cache.RawValues[cIdx])); copy(cRow, cache.RawValues[cIdx])
-		go QueueUpdate(sid, SHEET_NAMES.DATA_TIKTOK, cIdx, cRow)
+		cDirty := updateRowCache(cache, cIdx, cSt, cNote, "")
+		tickets = append(tickets, QueueUpdateCells(sid, SHEET_NAMES.DATA_TIKTOK, cIdx, cDirty))
+		dropLease(sid, cIdx)
 	}
 
-	// Update nick mới
+	// Update nick mới (Chỉ ghi các ô thực sự thay đổi)
+	dirty := make(RowCells)
 	for colIdx, val := range updateMap {
 		if colIdx >= 0 && colIdx < len(cache.RawValues[idx]) {
 			if colIdx == INDEX_DATA_TIKTOK.STATUS || colIdx == INDEX_DATA_TIKTOK.NOTE || colIdx == INDEX_DATA_TIKTOK.DEVICE_ID { continue }
 			cache.RawValues[idx][colIdx] = val
 			if colIdx < CACHE.CLEAN_COL_LIMIT { cache.CleanValues[idx][colIdx] = CleanString(val) }
+			dirty[colIdx] = val
 		}
 	}
-	updateRowCache(cache, idx, tSt, tNote, deviceId)
+	sealCellsLocked(sid, cache, idx, dirty) // Cột nhạy cảm Tool gửi lên -> Mã hóa trước khi vào Queue
+	for col, val := range updateRowCache(cache, idx, tSt, tNote, deviceId) { dirty[col] = val }
+	for col, val := range assignProxyLocked(sid, cache, idx, proxyPool, proxySetting) { dirty[col] = val }
 
 	newRow := make([]interface{}, len(cache.RawValues[idx])); copy(newRow, cache.RawValues[idx])
-	QueueUpdate(sid, SHEET_NAMES.DATA_TIKTOK, idx, newRow)
+	tickets = append(tickets, QueueUpdateCells(sid, SHEET_NAMES.DATA_TIKTOK, idx, dirty))
+	leaseExp := grantLease(sid, idx, deviceId) // Tool phải gọi /tool/heartbeat trước mốc này
+
+	view := profileRow(sid, newRow, deviceId, scopes) // Giải mã cột nhạy cảm cho Tool vừa nhận nick, che cột Token không được đọc
+	authProfile := MakeAuthProfile(view)
+	authProfile.ProxyDetail = proxyInfoFor(view, proxyPool)
+	STATE.SheetMutex.Unlock()
+
+	if err := waitJournal(tickets...); err != nil { return nil, fmt.Errorf("Lỗi ghi nhật ký (WAL), thử lại") }
 
 	msg := "Lấy nick thành công"
 	return &LoginResponse{
-		Status: "true", Type: typ, Messenger: msg, DeviceId: deviceId, RowIndex: RANGES.DATA_START_ROW + idx, SystemEmail: email,
-		AuthProfile: MakeAuthProfile(newRow), ActivityProfile: MakeActivityProfile(newRow), AiProfile: MakeAiProfile(newRow),
+		Status: "true", Type: typ, Messenger: msg, DeviceId: deviceId, RowIndex: RANGES.DATA_START_ROW + idx, SystemEmail: email, LeaseExpiresAt: leaseExp,
+		AuthProfile: authProfile, ActivityProfile: MakeActivityProfile(view), AiProfile: MakeAiProfile(view),
 	}, nil
 }
 
-// Đồng bộ RAM (Rất quan trọng)
-func updateRowCache(cache *SheetCacheData, idx int, newSt, newNote, newDev string) {
+// Đồng bộ RAM (Rất quan trọng). Trả về các ô đã đổi để đưa vào Queue.
+func updateRowCache(cache *SheetCacheData, idx int, newSt, newNote, newDev string) RowCells {
 	oldCleanSt := cache.CleanValues[idx][INDEX_DATA_TIKTOK.STATUS]
 	oldDev := cache.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID]
+	dirty := make(RowCells)
 
-	if newSt != "" { cache.RawValues[idx][INDEX_DATA_TIKTOK.STATUS] = newSt }
-	if newNote != "" { cache.RawValues[idx][INDEX_DATA_TIKTOK.NOTE] = newNote }
-	if newDev != "" { cache.RawValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID] = newDev }
+	if newSt != "" { cache.RawValues[idx][INDEX_DATA_TIKTOK.STATUS] = newSt; dirty[INDEX_DATA_TIKTOK.STATUS] = newSt }
+	if newNote != "" { cache.RawValues[idx][INDEX_DATA_TIKTOK.NOTE] = newNote; dirty[INDEX_DATA_TIKTOK.NOTE] = newNote }
+	if newDev != "" { cache.RawValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID] = newDev; dirty[INDEX_DATA_TIKTOK.DEVICE_ID] = newDev }
 
 	if newSt != "" && INDEX_DATA_TIKTOK.STATUS < CACHE.CLEAN_COL_LIMIT { cache.CleanValues[idx][INDEX_DATA_TIKTOK.STATUS] = CleanString(newSt) }
 	if newNote != "" && INDEX_DATA_TIKTOK.NOTE < CACHE.CLEAN_COL_LIMIT { cache.CleanValues[idx][INDEX_DATA_TIKTOK.NOTE] = CleanString(newNote) }
@@ -268,13 +309,8 @@ func updateRowCache(cache *SheetCacheData, idx int, newSt, newNote, newDev strin
 			cache.StatusMap[newStClean] = append(cache.StatusMap[newStClean], idx)
 		}
 	}
-	if newDev != "" {
-		newDevClean := CleanString(newDev)
-		if oldDev != newDevClean {
-			if oldDev != "" { delete(cache.AssignedMap, oldDev) } else { removeFromIntList(&cache.UnassignedList, idx) }
-			if newDev != "" { cache.AssignedMap[newDevClean] = idx } else { cache.UnassignedList = append(cache.UnassignedList, idx) }
-		}
-	}
+	if newDev != "" { reindexDevice(cache, idx, oldDev, CleanString(newDev)) }
+	return dirty
 }
 
 func parseUpdateDataLogin(body map[string]interface{}) map[int]interface{} {
@@ -299,6 +335,7 @@ func determineType(row []string) string {
 	return "login"
 }
 
+// getCleanupIndices: deviceId kèm Slot -> Chỉ dọn nick của đúng Slot này
 func getCleanupIndices(cache *SheetCacheData, deviceId string, targetIdx int, isResetCompleted bool) []int {
 	var list []int
 	checkList := []string{STATUS_READ.RUNNING, STATUS_READ.REGISTERING}
@@ -315,19 +352,19 @@ func getCleanupIndices(cache *SheetCacheData, deviceId string, targetIdx int, is
 }
 
 func doSelfHealing(sid string, idx int, missing string, cache *SheetCacheData) {
-	msg := "Nick thiếu " + missing + "\n" + time.Now().Format("02/01/2006 15:04:05")
+	msg := "Nick thiếu " + missing + "\n" + nowVN().Format("02/01/2006 15:04:05")
 	STATE.SheetMutex.Lock()
+	var dirty RowCells
 	if idx < len(cache.RawValues) {
-		updateRowCache(cache, idx, STATUS_WRITE.ATTENTION, msg, "")
+		dirty = updateRowCache(cache, idx, STATUS_WRITE.ATTENTION, msg, "")
 	}
-	fullRow := make([]interface{}, len(cache.RawValues[idx])); copy(fullRow, cache.RawValues[idx])
 	STATE.SheetMutex.Unlock()
-	go QueueUpdate(sid, SHEET_NAMES.DATA_TIKTOK, idx, fullRow)
+	QueueUpdateCells(sid, SHEET_NAMES.DATA_TIKTOK, idx, dirty).Wait()
 }
 
 // Logic tạo Note LOGIN: Tăng số lần nếu reset
 func tao_ghi_chu_chuan_login(oldNote, newStatus, mode string) string {
-	nowFull := time.Now().Add(7 * time.Hour).Format("02/01/2006 15:04:05")
+	nowFull := nowVN().Format("02/01/2006 15:04:05")
 	if mode == "new" { return fmt.Sprintf("%s\n%s", newStatus, nowFull) }
 	
 	oldNote = SafeString(oldNote)
@@ -41,7 +41,10 @@ func HandleMailData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for s, r := range rowsBySheet {
-		if len(r) > 0 { QueueAppend(tokenData.SpreadsheetID, s, r) }
+		if len(r) > 0 && QueueAppend(tokenData.SpreadsheetID, s, r).Wait() != nil {
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Lỗi ghi nhật ký (WAL), thử lại"})
+			return
+		}
 	}
 	json.NewEncoder(w).Encode(map[string]string{"status": "true", "messenger": "Đã tiếp nhận mail log"})
 }
@@ -101,13 +104,12 @@ func HandleReadMail(w http.ResponseWriter, r *http.Request) {
 	STATE.SheetMutex.RUnlock()
 
 	if found && markRead {
-		STATE.SheetMutex.RLock()
-		newRow := make([]interface{}, len(rows[targetIdx]))
-		copy(newRow, rows[targetIdx])
-		STATE.SheetMutex.RUnlock()
-		
-		newRow[7] = "TRUE"
-		QueueUpdate(sid, SHEET_NAMES.EMAIL_LOGGER, targetIdx, newRow)
+		// Chỉ ghi đúng ô "Đã đọc" (Cột H)
+		STATE.SheetMutex.Lock()
+		rows[targetIdx][7] = "TRUE"
+		ticket := QueueUpdateCells(sid, SHEET_NAMES.EMAIL_LOGGER, targetIdx, RowCells{7: "TRUE"})
+		STATE.SheetMutex.Unlock()
+		ticket.Wait()
 	}
 
 	if found {
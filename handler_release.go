@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+/*
+=================================================================================================
+📘 TÀI LIỆU API: TRẢ NICK / BÁO KẾT QUẢ (POST /tool/release)
+=================================================================================================
+
+1. MỤC ĐÍCH:
+   - Tool báo kết quả chạy 1 nick thay vì tự ghi col_0/col_1 qua /tool/updated.
+   - Server tự chọn Status, Note (Giữ số lần chạy) và xử lý DeviceId, đồng bộ RAM ngay lập tức.
+
+2. CẤU TRÚC BODY REQUEST:
+{
+  "token": "...",
+  "deviceId": "...",
+  "slot": 2,                  // (Tùy chọn) Có Slot -> Chỉ trả được nick của đúng Slot này
+  "row_index": 123,           // Dòng đã nhận từ /tool/login
+  "outcome": "completed",     // "completed" | "failed" | "banned" | "verify" | "pool"
+  "reason": "..."             // (Tùy chọn) Ghi thêm vào dòng đầu Note
+}
+
+3. BẢNG KẾT QUẢ:
+   - completed : "Hoàn thành"   | Giữ DeviceId (Để login_reset/auto_reset lấy lại)
+   - failed    : "Chú ý"        | Gỡ DeviceId
+   - banned    : "Bị khóa"      | Gỡ DeviceId
+   - verify    : "Cần xác minh" | Giữ DeviceId
+   - pool      : "Đăng nhập"/"Đăng ký" (Theo loại nick) | Gỡ DeviceId -> Trả về kho chung
+*/
+
+type ReleaseOutcome struct {
+	Status    string
+	KeepOwner bool
+}
+
+var RELEASE_OUTCOMES = map[string]ReleaseOutcome{
+	"completed": {STATUS_WRITE.COMPLETED, true},
+	"failed":    {STATUS_WRITE.ATTENTION, false},
+	"banned":    {STATUS_WRITE.BANNED, false},
+	"verify":    {STATUS_WRITE.VERIFY, true},
+	"pool":      {"", false}, // Status theo loại nick (determineType)
+}
+
+func HandleRelease(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"status":"false","messenger":"JSON Error"}`, 400); return
+	}
+
+	tokenData, ok := r.Context().Value("tokenData").(*TokenData)
+	if !ok { return }
+
+	rowIdx := -1
+	if v, ok := body["row_index"]; ok {
+		if val, ok := toFloat(v); ok { rowIdx = int(val) - RANGES.DATA_START_ROW }
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	slot, err := resolveSlot(tokenData, body)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
+	devKey := deviceKey(CleanString(body["deviceId"]), slot)
+	res, err := xu_ly_release(tokenData.SpreadsheetID, devKey, CleanString(body["slot"]) != "", rowIdx, CleanString(body["outcome"]), SafeString(body["reason"]))
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// deviceId: Giá trị cột DeviceId của Slot (deviceKey). explicitSlot: Body có "slot" -> So khớp cả Slot.
+func xu_ly_release(sid, deviceId string, explicitSlot bool, idx int, outcome, reason string) (res map[string]interface{}, err error) {
+	rule, ok := RELEASE_OUTCOMES[outcome]
+	if !ok { return nil, fmt.Errorf("Outcome không hợp lệ") }
+	if deviceId == "" { return nil, fmt.Errorf("Thiếu deviceId") }
+
+	cacheData, err := LayDuLieu(sid, SHEET_NAMES.DATA_TIKTOK, false)
+	if err != nil { return nil, fmt.Errorf("Lỗi tải dữ liệu") }
+
+	var ticket journalTicket
+	defer func() { // Chạy sau khi nhả SheetMutex
+		if err == nil && ticket.Wait() != nil { res, err = nil, fmt.Errorf("Lỗi ghi nhật ký (WAL), thử lại") }
+	}()
+	STATE.SheetMutex.Lock()
+	defer STATE.SheetMutex.Unlock()
+
+	if idx < 0 || idx >= len(cacheData.RawValues) { return nil, fmt.Errorf("Row không tồn tại") }
+	if !ownsSlot(cacheData.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID], deviceId, explicitSlot) { return nil, fmt.Errorf("Nick không thuộc thiết bị này") }
+
+	st := rule.Status
+	if st == "" {
+		st = STATUS_WRITE.LOGIN
+		if determineType(cacheData.CleanValues[idx]) == "register" { st = STATUS_WRITE.REGISTER }
+	}
+	noteHead := st
+	if reason != "" { noteHead = st + " - " + reason }
+	note := tao_ghi_chu_chuan_login(SafeString(cacheData.RawValues[idx][INDEX_DATA_TIKTOK.NOTE]), noteHead, "normal")
+
+	// Status + Note + DeviceId + 3 chỉ mục RAM đổi cùng lúc trong 1 Write Lock
+	dirty := updateRowCache(cacheData, idx, st, note, "")
+	if !rule.KeepOwner {
+		for col, val := range clearRowDevice(cacheData, idx) { dirty[col] = val }
+	}
+	ticket = QueueUpdateCells(sid, SHEET_NAMES.DATA_TIKTOK, idx, dirty)
+	dropLease(sid, idx)
+
+	return map[string]interface{}{
+		"status": "true", "messenger": "Đã trả nick", "row_index": RANGES.DATA_START_ROW + idx, "outcome": outcome, "status_write": st,
+	}, nil
+}
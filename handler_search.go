@@ -23,6 +23,7 @@ import (
   "sheet": "DataTiktok",      // (Optional) Tên sheet
   "limit": 50,                // (Optional) Giới hạn số dòng
   "return_cols": [],          // (Optional) Nếu RỖNG -> Lấy hết. Nếu có [0, 6] -> Chỉ lấy cột 0 và 6.
+                              // Cột Token không có quyền đọc (scopes) -> Trả về "***" (Xem service_scope.go)
 
   // --- BỘ LỌC CHUẨN ---
   "search_and": {
@@ -71,6 +72,14 @@ func HandleSearchData(w http.ResponseWriter, r *http.Request) {
 	sheetName := CleanString(body["sheet"])
 	if sheetName == "" { sheetName = SHEET_NAMES.DATA_TIKTOK }
 
+	// Quyền Token: Sheet khác DataTiktok cần admin, cột không được đọc bị che
+	scopes := tokenScopes(tokenData)
+	isDataTiktok := (sheetName == SHEET_NAMES.DATA_TIKTOK)
+	if !isDataTiktok && !scopes.Has(SCOPES.ADMIN) {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Token không có quyền đọc Sheet " + sheetName})
+		return
+	}
+
 	// 3. Tải dữ liệu Cache
 	cacheData, err := LayDuLieu(sid, sheetName, false)
 	if err != nil {
@@ -80,6 +89,12 @@ func HandleSearchData(w http.ResponseWriter, r *http.Request) {
 
 	// 4. Phân tích tham số
 	filters := parseFilterParams(body) // Dùng hàm chuẩn từ utils.go
+	if isDataTiktok {
+		if err := checkFilterCols(scopes, filters); err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+			return
+		}
+	}
 	
 	limit := 1000
 	if l, ok := body["limit"]; ok {
@@ -118,6 +133,7 @@ func HandleSearchData(w http.ResponseWriter, r *http.Request) {
 			item["row_index"] = i + RANGES.DATA_START_ROW
 			
 			rawRow := rows[i]
+			if isDataTiktok { rawRow = maskRow(rawRow, scopes) }
 			
 			// 🔥 QUAN TRỌNG: Dùng SafeString để convert mọi thứ về String an toàn, giữ nguyên hoa thường
 			
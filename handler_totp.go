@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+/*
+=================================================================================================
+📘 TÀI LIỆU API: LẤY MÃ 2FA (POST /tool/2fa)
+=================================================================================================
+
+1. MỤC ĐÍCH:
+   - Sinh mã TOTP (RFC 6238) từ Secret trong cột TWO_FA -> Tool không cần tự tính.
+   - Có thể lấy kèm ngay khi nhận nick: /tool/login { "with_totp": true } -> Trường "totp".
+
+2. CẤU TRÚC BODY REQUEST:
+{
+  "token": "...",
+  "deviceId": "...",          // Bắt buộc khi lấy theo row_index: Chỉ thiết bị đang giữ nick mới lấy được mã
+  "row_index": 123,           // Dòng cần lấy mã (Theo Sheet)
+  "secret": "JBSW Y3DP ...",  // (Tùy chọn) Dùng Secret này thay cho cột TWO_FA
+  "digits": 6,                // (Tùy chọn) Mặc định theo URI / TOTP.DEFAULT_DIGITS
+  "period": 30                // (Tùy chọn) Mặc định theo URI / TOTP.DEFAULT_PERIOD
+}
+
+3. RESPONSE:
+   - { "status": "true", "row_index": 123, "code": "123456", "next_code": "654321", "expires_in": 12, "digits": 6, "period": 30 }
+*/
+
+func HandleTotp(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, `{"status":"false","messenger":"JSON Error"}`, 400); return
+	}
+
+	tokenData, ok := r.Context().Value("tokenData").(*TokenData)
+	if !ok {
+		http.Error(w, `{"status":"false","messenger":"Lỗi xác thực"}`, 401)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	secret, rowIndex, err := xu_ly_lay_secret_2fa(tokenData.SpreadsheetID, CleanString(body["deviceId"]), body)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
+
+	digits, period := 0, 0
+	if v, ok := toFloat(body["digits"]); ok { digits = int(v) }
+	if v, ok := toFloat(body["period"]); ok { period = int(v) }
+
+	res, err := GenerateTotp(secret, digits, period)
+	if err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "true", "messenger": "Thành công", "row_index": rowIndex,
+		"code": res.Code, "next_code": res.NextCode, "expires_in": res.ExpiresIn, "digits": res.Digits, "period": res.Period,
+	})
+}
+
+// xu_ly_lay_secret_2fa: Secret trong Body, không có -> Cột TWO_FA của row_index
+func xu_ly_lay_secret_2fa(sid, deviceId string, body map[string]interface{}) (string, int, error) {
+	if s := SafeString(body["secret"]); s != "" { return s, 0, nil }
+
+	val, ok := toFloat(body["row_index"])
+	if !ok { return "", 0, fmt.Errorf("Thiếu row_index hoặc secret") }
+	idx := int(val) - RANGES.DATA_START_ROW
+
+	cache, err := LayDuLieu(sid, SHEET_NAMES.DATA_TIKTOK, false)
+	if err != nil { return "", 0, fmt.Errorf("Lỗi tải dữ liệu") }
+
+	STATE.SheetMutex.RLock()
+	defer STATE.SheetMutex.RUnlock()
+	if idx < 0 || idx >= len(cache.RawValues) { return "", 0, fmt.Errorf("Row không tồn tại") }
+	// Kiểm tra chủ nick TRƯỚC (Kể cả Secret dạng rõ): Token read:auth không được lấy mã của nick thiết bị khác
+	if !sameDevice(cache.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID], deviceId) { return "", 0, fmt.Errorf("Nick không thuộc thiết bị này") }
+	secret := gs(cache.RawValues[idx], INDEX_DATA_TIKTOK.TWO_FA)
+	if isEncrypted(secret) {
+		if secret, err = decryptCell(sid, INDEX_DATA_TIKTOK.TWO_FA, secret); err != nil { return "", 0, fmt.Errorf("Không giải mã được 2FA") }
+	}
+	return secret, int(val), nil
+}
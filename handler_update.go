@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -70,7 +71,7 @@ func HandleUpdateData(w http.ResponseWriter, r *http.Request) {
 	reqType := CleanString(body["type"])
 	if reqType == "" { reqType = "updated" }
 
-	res, err := xu_ly_update_logic(sid, deviceId, reqType, body)
+	res, err := xu_ly_update_logic(sid, deviceId, reqType, body, tokenScopes(tokenData))
 
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
@@ -80,10 +81,11 @@ func HandleUpdateData(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(res)
 }
 
-func xu_ly_update_logic(sid, deviceId, reqType string, body map[string]interface{}) (*UpdateResponse, error) {
+func xu_ly_update_logic(sid, deviceId, reqType string, body map[string]interface{}, scopes ScopeSet) (res *UpdateResponse, err error) {
 	sheetName := CleanString(body["sheet"])
 	if sheetName == "" { sheetName = SHEET_NAMES.DATA_TIKTOK }
 	isDataTiktok := (sheetName == SHEET_NAMES.DATA_TIKTOK)
+	if !isDataTiktok && !scopes.Has(SCOPES.ADMIN) { return nil, fmt.Errorf("Token không có quyền ghi Sheet %s", sheetName) }
 
 	cacheData, err := LayDuLieu(sid, sheetName, false)
 	if err != nil { return nil, fmt.Errorf("Lỗi tải dữ liệu") }
@@ -94,7 +96,17 @@ func xu_ly_update_logic(sid, deviceId, reqType string, body map[string]interface
 
 	updateData := prepareUpdateData(body)
 	if len(updateData) == 0 { return nil, fmt.Errorf("Updated block trống") }
+	if isDataTiktok {
+		if err := checkWritableCols(scopes, updateData); err != nil { return nil, err }
+		if err := checkFilterCols(scopes, filters); err != nil { return nil, err }
+	}
+	assignDev := deviceId // Gán DeviceId = Ghi cột DeviceId -> Cần quyền write:status
+	if isDataTiktok && !scopes.CanWrite(INDEX_DATA_TIKTOK.DEVICE_ID) { assignDev = "" }
 
+	var tickets []journalTicket
+	defer func() { // Chạy sau khi nhả SheetMutex
+		if err == nil && waitJournal(tickets...) != nil { res, err = nil, fmt.Errorf("Lỗi ghi nhật ký (WAL), thử lại") }
+	}()
 	STATE.SheetMutex.Lock()
 	defer STATE.SheetMutex.Unlock()
 
@@ -111,15 +123,18 @@ func xu_ly_update_logic(sid, deviceId, reqType string, body map[string]interface
 			if filters.HasFilter {
 				if !isRowMatched(cleanRows[idx], rows[idx], filters) { return nil, fmt.Errorf("Row không khớp Filter") }
 			}
-			applyUpdateToRow(cacheData, idx, updateData, deviceId, isDataTiktok)
-			QueueUpdate(sid, sheetName, idx, cacheData.RawValues[idx])
+			dirty := applyUpdateToRow(cacheData, idx, updateData, assignDev, isDataTiktok)
+			if isDataTiktok { sealCellsLocked(sid, cacheData, idx, dirty) }
+			tickets = append(tickets, QueueUpdateCells(sid, sheetName, idx, dirty))
+			if isDataTiktok { touchLeases(sid, deviceId, idx) } // Tool còn cập nhật = Còn sống
 			
+			view := profileRow(sid, cacheData.RawValues[idx], deviceId, scopes)
 			return &UpdateResponse{
 				Status: "true", Type: "updated", Messenger: "Cập nhật thành công",
 				RowIndex: rowIndexInput,
-				AuthProfile: MakeAuthProfile(cacheData.RawValues[idx]),
-				ActivityProfile: MakeActivityProfile(cacheData.RawValues[idx]),
-				AiProfile: MakeAiProfile(cacheData.RawValues[idx]),
+				AuthProfile: MakeAuthProfile(view),
+				ActivityProfile: MakeActivityProfile(view),
+				AiProfile: MakeAiProfile(view),
 			}, nil
 		} else { return nil, fmt.Errorf("Row không tồn tại") }
 	}
@@ -129,8 +144,10 @@ func xu_ly_update_logic(sid, deviceId, reqType string, body map[string]interface
 
 	for i, cleanRow := range cleanRows {
 		if isRowMatched(cleanRow, rows[i], filters) {
-			applyUpdateToRow(cacheData, i, updateData, deviceId, isDataTiktok)
-			QueueUpdate(sid, sheetName, i, cacheData.RawValues[i])
+			dirty := applyUpdateToRow(cacheData, i, updateData, assignDev, isDataTiktok)
+			if isDataTiktok { sealCellsLocked(sid, cacheData, i, dirty) }
+			tickets = append(tickets, QueueUpdateCells(sid, sheetName, i, dirty))
+			if isDataTiktok { touchLeases(sid, deviceId, i) }
 			updatedCount++
 			lastUpdatedIdx = i
 			lastUpdatedRow = cacheData.RawValues[i]
@@ -147,10 +164,11 @@ func xu_ly_update_logic(sid, deviceId, reqType string, body map[string]interface
 		}, nil
 	}
 
+	view := profileRow(sid, lastUpdatedRow, deviceId, scopes)
 	return &UpdateResponse{
 		Status: "true", Type: "updated", Messenger: "Cập nhật thành công",
 		RowIndex: RANGES.DATA_START_ROW + lastUpdatedIdx,
-		AuthProfile: MakeAuthProfile(lastUpdatedRow), ActivityProfile: MakeActivityProfile(lastUpdatedRow), AiProfile: MakeAiProfile(lastUpdatedRow),
+		AuthProfile: MakeAuthProfile(view), ActivityProfile: MakeActivityProfile(view), AiProfile: MakeAiProfile(view),
 	}, nil
 }
 
@@ -170,8 +188,10 @@ func prepareUpdateData(body map[string]interface{}) map[int]interface{} {
 	return cols
 }
 
-func applyUpdateToRow(cache *SheetCacheData, idx int, updateCols map[int]interface{}, deviceId string, isDataTiktok bool) {
+// applyUpdateToRow: Cập nhật RAM và trả về các ô đã đổi (Column-level dirty tracking)
+func applyUpdateToRow(cache *SheetCacheData, idx int, updateCols map[int]interface{}, deviceId string, isDataTiktok bool) RowCells {
 	row := cache.RawValues[idx]
+	dirty := make(RowCells)
 	cleanRow := cache.CleanValues[idx]
 	oldStatus := cleanRow[INDEX_DATA_TIKTOK.STATUS]
 	oldDev := cleanRow[INDEX_DATA_TIKTOK.DEVICE_ID]
@@ -185,14 +205,16 @@ func applyUpdateToRow(cache *SheetCacheData, idx int, updateCols map[int]interfa
 		if colIdx >= 0 && colIdx < len(row) {
 			row[colIdx] = val
 			if colIdx < CACHE.CLEAN_COL_LIMIT { cleanRow[colIdx] = CleanString(val) }
+			dirty[colIdx] = val
 		}
 	}
 
 	// 2. Logic DataTiktok (Sync Map & Note)
 	if isDataTiktok {
-		if deviceId != "" {
+		if deviceId != "" && !sameDevice(oldDev, deviceId) { // Cùng thiết bị -> Giữ nguyên Slot
 			row[INDEX_DATA_TIKTOK.DEVICE_ID] = deviceId
 			cleanRow[INDEX_DATA_TIKTOK.DEVICE_ID] = CleanString(deviceId)
+			dirty[INDEX_DATA_TIKTOK.DEVICE_ID] = deviceId
 		}
 
 		_, hasSt := updateCols[INDEX_DATA_TIKTOK.STATUS]
@@ -206,6 +228,7 @@ func applyUpdateToRow(cache *SheetCacheData, idx int, updateCols map[int]interfa
 			
 			row[INDEX_DATA_TIKTOK.NOTE] = finalNote
 			cleanRow[INDEX_DATA_TIKTOK.NOTE] = CleanString(finalNote)
+			dirty[INDEX_DATA_TIKTOK.NOTE] = finalNote
 		}
 
 		// Sync RAM
@@ -214,18 +237,15 @@ func applyUpdateToRow(cache *SheetCacheData, idx int, updateCols map[int]interfa
 			removeFromStatusMap(cache.StatusMap, oldStatus, idx)
 			cache.StatusMap[newStatus] = append(cache.StatusMap[newStatus], idx)
 		}
-		newDev := cleanRow[INDEX_DATA_TIKTOK.DEVICE_ID]
-		if newDev != oldDev {
-			if oldDev != "" { delete(cache.AssignedMap, oldDev) } else { removeFromIntList(&cache.UnassignedList, idx) }
-			if newDev != "" { cache.AssignedMap[newDev] = idx } else { cache.UnassignedList = append(cache.UnassignedList, idx) }
-		}
+		reindexDevice(cache, idx, oldDev, cleanRow[INDEX_DATA_TIKTOK.DEVICE_ID])
 	}
-	cache.LastAccessed = time.Now().UnixMilli()
+	atomic.StoreInt64(&cache.LastAccessed, time.Now().UnixMilli())
+	return dirty
 }
 
 // Logic tạo Note UPDATE: GIỮ NGUYÊN số lần chạy
 func tao_ghi_chu_chuan_update(oldNote, content, newStatus string) string {
-	nowFull := time.Now().Add(7 * time.Hour).Format("02/01/2006 15:04:05")
+	nowFull := nowVN().Format("02/01/2006 15:04:05")
 	oldNote = SafeString(oldNote)
 	count := 1
 	// Bắt số lần từ note cũ
@@ -43,7 +43,16 @@ func main() {
 	fmt.Println("🔄 [INIT] Connecting to Services...")
 	// 🔥 Dù credJSON rỗng vẫn gọi hàm init, hàm init mới (ở trên) sẽ xử lý an toàn
 	InitAuthService(credJSON) 
-	InitGoogleService(credJSON)
+	InitSheetStore(credJSON)
+	InitCrypto()    // Khóa gốc mã hóa cột nhạy cảm (DATA_MASTER_KEY)
+	ReplayJournal() // Nạp lại các thay đổi chưa kịp ghi trước lần sập trước
+	go RunSheetWatcher() // Dò chỉnh sửa tay trên DataTiktok
+	go RunAuthJanitor()  // Dọn Token Cache & Rate Limit hết hạn
+	go RunLeaseReaper()  // Thu hồi nick quá hạn thuê (Device chết)
+	go RunDailyReset()   // Reset TODAY_* lúc 0h theo múi giờ Tenant
+	go RunDeviceSaver()  // Ghi Sổ thiết bị xuống đĩa
+	go RunProxyWatcher() // Đánh dấu nick có Proxy sắp hết hạn
+	go RunTokenWatcher() // Xóa Cache Token bị thu hồi / đổi hạn trên Firebase
 
 	mux := http.NewServeMux()
 	
@@ -60,13 +69,24 @@ func main() {
 		}
 	}
 
-	mux.HandleFunc("/tool/login", wrap(HandleAccountAction))
+	// Quyền Token (scopes, xem service_scope.go): Nhận / trả nick = write:status, API quản trị = admin
+	mux.HandleFunc("/tool/login", wrap(requireScope("write:status", HandleAccountAction)))
+	mux.HandleFunc("/tool/heartbeat", wrap(requireScope("write:status", HandleHeartbeat)))
+	mux.HandleFunc("/tool/release", wrap(requireScope("write:status", HandleRelease)))
+	mux.HandleFunc("/tool/counter", wrap(requireScope("write:activity", HandleCounter)))
+	mux.HandleFunc("/tool/2fa", wrap(requireScope("read:auth", HandleTotp)))
 	mux.HandleFunc("/tool/updated", wrap(HandleUpdateData))
 	mux.HandleFunc("/tool/search", wrap(HandleSearchData))
-	mux.HandleFunc("/tool/log", wrap(HandleLogData))
-	mux.HandleFunc("/tool/read-mail", wrap(HandleReadMail))
-	mux.HandleFunc("/tool/create-sheets", wrap(HandleCreateSheets))
-	mux.HandleFunc("/tool/updated-cache", wrap(HandleClearCache))
+	mux.HandleFunc("/tool/log", wrap(requireScope("write:activity", HandleLogData)))
+	mux.HandleFunc("/tool/read-mail", wrap(requireScope("read:auth", HandleReadMail)))
+	mux.HandleFunc("/tool/create-sheets", wrap(requireScope(SCOPES.ADMIN, HandleCreateSheets)))
+	mux.HandleFunc("/tool/updated-cache", wrap(requireScope(SCOPES.ADMIN, HandleClearCache)))
+	mux.HandleFunc("/tool/dead-letter", wrap(requireScope(SCOPES.ADMIN, HandleDeadLetter)))
+	mux.HandleFunc("/tool/stats", wrap(requireScope(SCOPES.ADMIN, HandleStats)))
+	mux.HandleFunc("/tool/devices", wrap(requireScope(SCOPES.ADMIN, HandleDevices)))
+	mux.HandleFunc("/tool/proxy-report", wrap(requireScope(SCOPES.ADMIN, HandleProxyReport)))
+	mux.HandleFunc("/tool/encryption", wrap(requireScope(SCOPES.ADMIN, HandleEncryption)))
+	mux.HandleFunc("/tool/tokens", OperatorMiddleware(HandleTokens)) // Khóa vận hành (TOKEN_ADMIN_KEY), không qua Token Tenant
 
 	// Health Check
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -91,8 +111,12 @@ func main() {
 	<-quit
 
 	fmt.Println("🛑 [SIGTERM] Shutting down...")
+	// Lấy danh sách trước rồi nhả Lock (FlushQueue tự khóa QueueMutex bên trong)
 	STATE.QueueMutex.Lock()
-	for sid := range STATE.WriteQueue { FlushQueue(sid, true) }
+	sids := make([]string, 0, len(STATE.WriteQueue))
+	for sid := range STATE.WriteQueue { sids = append(sids, sid) }
 	STATE.QueueMutex.Unlock()
+	for _, sid := range sids { FlushQueue(sid, true) }
+	SaveDevices()
 	fmt.Println("✅ Shutdown complete.")
 }
@@ -8,8 +8,10 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	firebase "firebase.google.com/go/v4"
@@ -35,7 +37,9 @@ var AuthInitError error
 // TokenRequest: Struct dùng để hứng JSON từ client gửi lên.
 // Dùng struct nhanh hơn map[string]interface{} về hiệu năng.
 type TokenRequest struct {
-	Token string `json:"token"` // Trường "token" trong JSON body
+	Token      string `json:"token"`       // Trường "token" trong JSON body
+	DeviceId   string `json:"deviceId"`    // (Tùy chọn) Ghi nhận vào Sổ thiết bị
+	AppVersion string `json:"app_version"` // (Tùy chọn) Phiên bản Tool trên thiết bị
 }
 
 // =================================================================================================
@@ -152,6 +156,12 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Múi giờ Tenant (Dùng cho reset hằng ngày), Kho Proxy, Lease & Sổ thiết bị
+		rememberTenantZone(authRes.SpreadsheetID, authRes.Data)
+		rememberProxyPool(authRes.SpreadsheetID, authRes.Data)
+		rememberLease(authRes.SpreadsheetID, authRes.Data)
+		TouchDevice(authRes.SpreadsheetID, req.DeviceId, req.AppVersion)
+
 		// ✅ THÀNH CÔNG: Lưu thông tin Token vào Context
 		// Để các hàm xử lý phía sau (HandlerLogin, HandlerUpdate) có thể dùng ngay mà không cần query lại.
 		ctx := context.WithValue(r.Context(), "tokenData", &TokenData{
@@ -238,6 +248,11 @@ func CheckToken(token string) AuthResult {
 		setCache(token, nil, true, "Không có spreadsheetsId", TOKEN_RULES.BLOCK_TTL_MS)
 		return AuthResult{IsValid: false, Messenger: "Không có spreadsheetsId"}
 	}
+	// Trường hợp: Admin đã thu hồi (blocked = true, xem service_token_admin.go)
+	if tokenBlocked(data) {
+		setCache(token, nil, true, "Token bị block", TOKEN_RULES.BLOCK_TTL_MS)
+		return AuthResult{IsValid: false, Messenger: "Token bị block"}
+	}
 
 	// 4. KIỂM TRA HẠN SỬ DỤNG (Smart Time Check)
 	expStr := fmt.Sprintf("%v", data["expired"])
@@ -279,7 +294,7 @@ func CheckToken(token string) AuthResult {
 // Hỗ trợ: Timestamp số, ISO 8601, Ngày/Tháng/Năm VN...
 func parseSmartTime(dateStr string) time.Time {
 	// Ép cứng múi giờ Việt Nam (+7)
-	vnZone := time.FixedZone("UTC+7", 7*3600)
+	vnZone := VN_ZONE
 	s := strings.TrimSpace(dateStr)
 
 	// 1. Kiểm tra dạng số (Timestamp) - Ưu tiên cao nhất
@@ -390,6 +405,7 @@ func CheckUserRateLimit(token string) bool {
 	
 	// Nếu chưa có user này -> Tạo mới
 	if !exists {
+		if len(STATE.RateLimit) >= TOKEN_RULES.RATE_MAX_KEYS { evictRateLimitLocked(now) }
 		rec = &RateLimitData{LastReset: now, Count: 0}
 		STATE.RateLimit[token] = rec
 	}
@@ -408,7 +424,13 @@ func CheckUserRateLimit(token string) bool {
 func setCache(token string, data *TokenData, isInvalid bool, msg string, ttl int64) {
 	STATE.TokenMutex.Lock()
 	defer STATE.TokenMutex.Unlock() // Đảm bảo luôn mở khóa khi xong việc
-	
+
+	// Giới hạn cứng: Đầy -> Đá bớt trước khi thêm (Chống spam Token ngẫu nhiên làm tràn RAM)
+	if _, exists := STATE.TokenCache[token]; !exists && len(STATE.TokenCache) >= CACHE.TOKEN_MAX_KEYS {
+		evictTokenCacheLocked()
+	}
+	if isInvalid { atomic.AddInt64(&STATE.Stats.TokenNegatives, 1) }
+
 	cached := &CachedToken{
 		IsInvalid:  isInvalid,
 		Msg:        msg,
@@ -426,3 +448,109 @@ func deleteTokenCache(token string) {
 	defer STATE.TokenMutex.Unlock() // Đảm bảo luôn mở khóa
 	delete(STATE.TokenCache, token)
 }
+
+// =================================================================================================
+// 🧹 PHẦN 4: JANITOR (DỌN DẸP TOKEN CACHE & RATE LIMIT)
+// =================================================================================================
+
+// RunAuthJanitor: Chạy nền (main.go). Định kỳ xóa Token hết hạn & bản ghi Rate Limit nhàn rỗi.
+func RunAuthJanitor() {
+	ticker := time.NewTicker(time.Duration(TOKEN_RULES.SWEEP_MS) * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		SweepAuthCaches()
+	}
+}
+
+// SweepAuthCaches: 1 lượt dọn dẹp
+func SweepAuthCaches() {
+	now := time.Now().UnixMilli()
+	atomic.AddInt64(&STATE.Stats.TokenSweeps, 1)
+
+	STATE.TokenMutex.Lock()
+	for token, c := range STATE.TokenCache {
+		if now >= c.ExpiryTime {
+			delete(STATE.TokenCache, token)
+			atomic.AddInt64(&STATE.Stats.TokenExpired, 1)
+		}
+	}
+	STATE.TokenMutex.Unlock()
+
+	STATE.RateMutex.Lock()
+	for token, rec := range STATE.RateLimit {
+		if now-rec.LastReset > TOKEN_RULES.RATE_IDLE_MS {
+			delete(STATE.RateLimit, token)
+			atomic.AddInt64(&STATE.Stats.RateExpired, 1)
+		}
+	}
+	STATE.RateMutex.Unlock()
+}
+
+// evictTokenCacheLocked: Đá ~10% Cache. Ưu tiên: Hết hạn -> Token rác (Negative) -> Sắp hết hạn nhất.
+// Yêu cầu đang giữ TokenMutex.
+func evictTokenCacheLocked() {
+	now := time.Now().UnixMilli()
+	target := CACHE.TOKEN_MAX_KEYS / 10
+	if target < 1 { target = 1 }
+
+	type candidate struct {
+		token string
+		rank  int // 0 = Hết hạn, 1 = Negative, 2 = Token đúng
+		exp   int64
+	}
+	list := make([]candidate, 0, len(STATE.TokenCache))
+	for token, c := range STATE.TokenCache {
+		rank := 2
+		if now >= c.ExpiryTime { rank = 0 } else if c.IsInvalid { rank = 1 }
+		list = append(list, candidate{token, rank, c.ExpiryTime})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].rank != list[j].rank { return list[i].rank < list[j].rank }
+		return list[i].exp < list[j].exp
+	})
+	for i := 0; i < target && i < len(list); i++ {
+		delete(STATE.TokenCache, list[i].token)
+		atomic.AddInt64(&STATE.Stats.TokenEvicted, 1)
+	}
+}
+
+// evictRateLimitLocked: Đá các bản ghi cũ nhất khi vượt RATE_MAX_KEYS. Yêu cầu đang giữ RateMutex.
+func evictRateLimitLocked(now int64) {
+	// Lượt 1: Bỏ bản ghi đã qua cửa sổ (Không còn ý nghĩa chặn)
+	for token, rec := range STATE.RateLimit {
+		if now-rec.LastReset > TOKEN_RULES.WINDOW_MS {
+			delete(STATE.RateLimit, token)
+			atomic.AddInt64(&STATE.Stats.RateEvicted, 1)
+		}
+	}
+	// Lượt 2: Vẫn đầy (Đang bị tấn công dồn dập) -> Bỏ bản ghi cũ nhất
+	for len(STATE.RateLimit) >= TOKEN_RULES.RATE_MAX_KEYS {
+		oldestToken, oldest := "", int64(0)
+		for token, rec := range STATE.RateLimit {
+			if oldestToken == "" || rec.LastReset < oldest { oldestToken, oldest = token, rec.LastReset }
+		}
+		delete(STATE.RateLimit, oldestToken)
+		atomic.AddInt64(&STATE.Stats.RateEvicted, 1)
+	}
+}
+
+// AuthCacheStats: Số liệu cho /tool/stats
+func AuthCacheStats() map[string]int64 {
+	STATE.TokenMutex.RLock()
+	tokenSize := len(STATE.TokenCache)
+	STATE.TokenMutex.RUnlock()
+	STATE.RateMutex.Lock()
+	rateSize := len(STATE.RateLimit)
+	STATE.RateMutex.Unlock()
+
+	return map[string]int64{
+		"token_cache_size": int64(tokenSize),
+		"rate_limit_size":  int64(rateSize),
+		"token_sweeps":     atomic.LoadInt64(&STATE.Stats.TokenSweeps),
+		"token_expired":    atomic.LoadInt64(&STATE.Stats.TokenExpired),
+		"token_evicted":    atomic.LoadInt64(&STATE.Stats.TokenEvicted),
+		"token_negatives":  atomic.LoadInt64(&STATE.Stats.TokenNegatives),
+		"rate_expired":     atomic.LoadInt64(&STATE.Stats.RateExpired),
+		"rate_evicted":     atomic.LoadInt64(&STATE.Stats.RateEvicted),
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/v4/db"
+)
+
+// =================================================================================================
+// 🔒 MÃ HÓA CỘT NHẠY CẢM (ENVELOPE ENCRYPTION)
+// =================================================================================================
+// - Khóa gốc (KEK): Env DATA_MASTER_KEY (32 byte Base64 / Hex, sai định dạng -> Dừng Server). Không có -> Tắt mã hóa
+//   (Ô đã mã hóa vẫn giữ nguyên, không giải được).
+// - Mỗi Tenant 1 chuỗi khóa dữ liệu (DEK, AES-256) có phiên bản. DEK được bọc bằng KEK và lưu trên Firebase tại
+//   <ENCRYPTION.KEY_NODE>/<SafeIdent(sid)> (Ghi bằng Transaction). Xoay khóa = Thêm phiên bản mới, giữ khóa cũ để đọc ô chưa kịp mã hóa lại.
+// - Sheet đã có bản mã mà không tìm thấy chuỗi khóa -> Không tạo khóa mới (Fail closed), ô rõ giữ nguyên cho tới khi khôi phục khóa.
+// - Ô mã hóa: "enc:v<Phiên bản>:<Base64(Nonce|Ciphertext)>" (AES-GCM, AAD = Số cột -> Không tráo ô giữa các cột).
+// - Cache RAM (RawValues), Write Queue, WAL & Sheet chỉ chứa bản mã. Chỉ giải mã khi dựng AuthProfile cho Tool đang giữ nick.
+// - Giá trị rõ đi vào từ Tool (/tool/login "updated", /tool/updated) hoặc Operator gõ tay (Nạp / hợp nhất Sheet)
+//   đều được mã hóa ngay & ghi lại qua Write Queue.
+
+type keyRing struct {
+	Active  int            `json:"active"`
+	Wrapped map[int]string `json:"keys"` // Phiên bản -> DEK đã bọc (Base64)
+	keys    map[int][]byte // Phiên bản -> DEK (Chỉ trong RAM)
+}
+
+var tenantKeys = struct {
+	sync.Mutex
+	Master cipher.AEAD
+	Rings  map[string]*keyRing
+	Sealed map[string]bool // sid -> Sheet đã có bản mã (Mất chuỗi khóa thì KHÔNG được tạo khóa mới)
+}{
+	Rings:  make(map[string]*keyRing),
+	Sealed: make(map[string]bool),
+}
+
+var (
+	errNoKeyRing   = errors.New("Tenant chưa có khóa dữ liệu")
+	errKeyRingLost = errors.New("Mất chuỗi khóa dữ liệu trong khi Sheet đã có ô mã hóa -> Dừng mã hóa (Khôi phục Node " + ENCRYPTION.KEY_NODE + ")")
+)
+
+// keyRingStore: Nơi lưu chuỗi khóa đã bọc (JSON của keyRing)
+type keyRingStore interface {
+	Load(sid string) ([]byte, error)                                        // nil = Tenant chưa có khóa
+	Update(sid string, fn func(cur []byte) ([]byte, error)) ([]byte, error) // Đọc-sửa-ghi nguyên tử, trả về bản đã lưu
+}
+
+var keyStore keyRingStore = firebaseKeyStore{}
+// InitCrypto: Đọc khóa gốc (main.go)
+func InitCrypto() {
+	raw := strings.TrimSpace(os.Getenv("DATA_MASTER_KEY"))
+	if raw == "" {
+		fmt.Println("ℹ️ [CRYPTO] Không có DATA_MASTER_KEY -> Tắt mã hóa cột nhạy cảm.")
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) != 32 { key, err = hex.DecodeString(raw) }
+	if err != nil || len(key) != 32 {
+		// Không tự suy khóa (Gõ sai 1 ký tự = Khóa gốc khác -> Không mở được DEK cũ)
+		log.Fatalf("❌ [CRYPTO] DATA_MASTER_KEY phải là 32 byte dạng Base64 hoặc Hex (openssl rand -base64 32)")
+	}
+	aead, err := newAEAD(key)
+	if err != nil { log.Fatalf("❌ [CRYPTO] Khóa gốc lỗi: %v", err) }
+	tenantKeys.Lock()
+	tenantKeys.Master = aead
+	tenantKeys.Unlock()
+	fmt.Println("✅ [CRYPTO] Đã bật mã hóa cột nhạy cảm.")
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil { return nil, err }
+	return cipher.NewGCM(block)
+}
+
+// cryptoEnabled: Có khóa gốc
+func cryptoEnabled() bool {
+	tenantKeys.Lock()
+	defer tenantKeys.Unlock()
+	return tenantKeys.Master != nil
+}
+
+// isSensitiveCol: Cột DataTiktok cần mã hóa
+func isSensitiveCol(col int) bool {
+	for _, c := range ENCRYPTION.COLUMNS {
+		if c == col { return true }
+	}
+	return false
+}
+
+// isEncrypted: Ô đã mã hóa
+func isEncrypted(val string) bool { return strings.HasPrefix(val, ENCRYPTION.PREFIX) }
+
+// firebaseKeyStore: Lưu tại <ENCRYPTION.KEY_NODE>/<SafeIdent(sid)> trên Firebase (Cùng chỗ với Token của Tenant,
+// không phụ thuộc đĩa của Server -> Restart / đổi máy vẫn giải mã được)
+type firebaseKeyStore struct{}
+
+type keyRingNode struct {
+	Ring      string `json:"ring"` // JSON dạng chuỗi (Firebase tự đổi Object có Key số liên tiếp thành Mảng)
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func (firebaseKeyStore) ref(sid string) (*db.Ref, error) {
+	if firebaseDB == nil { return nil, fmt.Errorf("Chưa kết nối Firebase") }
+	return firebaseDB.NewRef(ENCRYPTION.KEY_NODE + "/" + SafeIdent(sid)), nil
+}
+
+func (s firebaseKeyStore) Load(sid string) ([]byte, error) {
+	ref, err := s.ref(sid)
+	if err != nil { return nil, err }
+	var node keyRingNode
+	if err := ref.Get(context.Background(), &node); err != nil { return nil, err }
+	if node.Ring == "" { return nil, nil }
+	return []byte(node.Ring), nil
+}
+
+func (s firebaseKeyStore) Update(sid string, fn func(cur []byte) ([]byte, error)) ([]byte, error) {
+	ref, err := s.ref(sid)
+	if err != nil { return nil, err }
+	var saved []byte
+	err = ref.Transaction(context.Background(), func(tn db.TransactionNode) (interface{}, error) {
+		var node keyRingNode
+		if err := tn.Unmarshal(&node); err != nil { return nil, err }
+		var cur []byte
+		if node.Ring != "" { cur = []byte(node.Ring) }
+		next, err := fn(cur)
+		if err != nil { return nil, err }
+		saved = next
+		return keyRingNode{Ring: string(next), UpdatedAt: time.Now().UnixMilli()}, nil
+	})
+	if err != nil { return nil, err }
+	return saved, nil
+}
+
+// keyRingLocked: Chuỗi khóa của sid (Nạp từ keyStore, create = true -> Tạo phiên bản 1 nếu chưa có). Yêu cầu giữ tenantKeys.
+func keyRingLocked(sid string, create bool) (*keyRing, error) {
+	if r, ok := tenantKeys.Rings[sid]; ok { return r, nil }
+	if tenantKeys.Master == nil { return nil, fmt.Errorf("Chưa cấu hình DATA_MASTER_KEY") }
+
+	raw, err := keyStore.Load(sid)
+	if err != nil {
+		log.Printf("❌ [CRYPTO] %s: Đọc chuỗi khóa: %v", sid, err)
+		return nil, fmt.Errorf("Lỗi đọc khóa dữ liệu")
+	}
+	if raw == nil {
+		if !create { return nil, errNoKeyRing }
+		if tenantKeys.Sealed[sid] { return nil, errKeyRingLost }
+		raw, err = keyStore.Update(sid, func(cur []byte) ([]byte, error) {
+			if cur != nil { return cur, nil } // Server khác vừa tạo -> Dùng chung
+			return appendKey(nil)
+		})
+		if err != nil {
+			log.Printf("❌ [CRYPTO] %s: Lưu chuỗi khóa: %v", sid, err)
+			return nil, fmt.Errorf("Lỗi lưu khóa dữ liệu")
+		}
+	}
+	r, err := parseKeyRing(raw)
+	if err != nil { return nil, fmt.Errorf("Đọc khóa %s: %v", sid, err) }
+	tenantKeys.Rings[sid] = r
+	return r, nil
+}
+
+// parseKeyRing: JSON -> keyRing & giải bọc toàn bộ DEK (Sai khóa gốc -> Lỗi, không tạo khóa mới)
+func parseKeyRing(raw []byte) (*keyRing, error) {
+	r := &keyRing{Wrapped: make(map[int]string), keys: make(map[int][]byte)}
+	if err := json.Unmarshal(raw, r); err != nil { return nil, err }
+	for ver, w := range r.Wrapped {
+		dek, err := unwrapKey(w)
+		if err != nil { return nil, fmt.Errorf("Giải bọc khóa v%d: %v", ver, err) }
+		r.keys[ver] = dek
+	}
+	if r.keys[r.Active] == nil { return nil, fmt.Errorf("Thiếu khóa đang dùng v%d", r.Active) }
+	return r, nil
+}
+
+// appendKey: Thêm DEK mới (Phiên bản lớn nhất + 1) vào chuỗi khóa & đặt làm phiên bản đang dùng. Yêu cầu giữ tenantKeys.
+func appendKey(cur []byte) ([]byte, error) {
+	r := &keyRing{}
+	if cur != nil {
+		if err := json.Unmarshal(cur, r); err != nil { return nil, err }
+	}
+	if r.Wrapped == nil { r.Wrapped = make(map[int]string) }
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil { return nil, err }
+	w, err := wrapKey(dek)
+	if err != nil { return nil, err }
+	ver := r.Active + 1
+	for v := range r.Wrapped { if v >= ver { ver = v + 1 } }
+	r.Wrapped[ver] = w
+	r.Active = ver
+	return json.Marshal(r)
+}
+
+// addKeyLocked: Xoay khóa -> Lưu phiên bản mới vào keyStore TRƯỚC khi dùng. Yêu cầu giữ tenantKeys.
+func addKeyLocked(sid string) (int, error) {
+	raw, err := keyStore.Update(sid, appendKey)
+	if err != nil {
+		log.Printf("❌ [CRYPTO] %s: Lưu chuỗi khóa: %v", sid, err)
+		return 0, fmt.Errorf("Lỗi lưu khóa dữ liệu")
+	}
+	r, err := parseKeyRing(raw)
+	if err != nil { return 0, err }
+	tenantKeys.Rings[sid] = r
+	return r.Active, nil
+}
+
+// guardKeyRing: Sheet đã có bản mã mà keyStore không còn chuỗi khóa -> Chặn tạo khóa mới (Fail closed)
+func guardKeyRing(sid string, cache *SheetCacheData) error {
+	tenantKeys.Lock()
+	_, loaded := tenantKeys.Rings[sid]
+	tenantKeys.Unlock()
+	if loaded { return nil }
+
+	sealed := false
+	STATE.SheetMutex.RLock()
+	for _, row := range cache.RawValues {
+		for _, col := range ENCRYPTION.COLUMNS {
+			if isEncrypted(gs(row, col)) { sealed = true; break }
+		}
+		if sealed { break }
+	}
+	STATE.SheetMutex.RUnlock()
+	if !sealed { return nil }
+
+	tenantKeys.Lock()
+	defer tenantKeys.Unlock()
+	tenantKeys.Sealed[sid] = true
+	if _, err := keyRingLocked(sid, false); err != nil {
+		if err == errNoKeyRing { return errKeyRingLost }
+		return err
+	}
+	return nil
+}
+
+func wrapKey(dek []byte) (string, error) {
+	nonce := make([]byte, tenantKeys.Master.NonceSize())
+	if _, err := rand.Read(nonce); err != nil { return "", err }
+	return base64.StdEncoding.EncodeToString(tenantKeys.Master.Seal(nonce, nonce, dek, nil)), nil
+}
+
+func unwrapKey(w string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(w)
+	ns := tenantKeys.Master.NonceSize()
+	if err != nil || len(raw) < ns { return nil, fmt.Errorf("Khóa bọc hỏng") }
+	return tenantKeys.Master.Open(nil, raw[:ns], raw[ns:], nil)
+}
+
+// encryptCell: Mã hóa giá trị rõ bằng DEK đang dùng của Tenant
+func encryptCell(sid string, col int, plain string) (string, error) {
+	tenantKeys.Lock()
+	defer tenantKeys.Unlock()
+	r, err := keyRingLocked(sid, true)
+	if err != nil { return "", err }
+	return sealWith(r.keys[r.Active], r.Active, col, plain)
+}
+
+func sealWith(dek []byte, ver, col int, plain string) (string, error) {
+	aead, err := newAEAD(dek)
+	if err != nil { return "", err }
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil { return "", err }
+	ct := aead.Seal(nonce, nonce, []byte(plain), []byte(strconv.Itoa(col)))
+	return ENCRYPTION.PREFIX + strconv.Itoa(ver) + ":" + base64.RawURLEncoding.EncodeToString(ct), nil
+}
+
+// splitCell: Tách "enc:v<ver>:<payload>" (ver = 0 nếu không phải bản mã)
+func splitCell(val string) (int, string) {
+	if !isEncrypted(val) { return 0, "" }
+	rest := strings.TrimPrefix(val, ENCRYPTION.PREFIX)
+	i := strings.IndexByte(rest, ':')
+	if i <= 0 { return 0, "" }
+	ver, _ := strconv.Atoi(rest[:i])
+	return ver, rest[i+1:]
+}
+
+// cellVersion: Phiên bản khóa của ô đã mã hóa (0 = Không phải bản mã)
+func cellVersion(val string) int {
+	ver, _ := splitCell(val)
+	return ver
+}
+
+// decryptCell: Giải mã ô. Giá trị rõ (Chưa mã hóa) trả về nguyên văn.
+func decryptCell(sid string, col int, val string) (string, error) {
+	if !isEncrypted(val) { return val, nil }
+	ver, payload := splitCell(val)
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if ver == 0 || err != nil { return "", fmt.Errorf("Ô mã hóa hỏng") }
+
+	tenantKeys.Lock()
+	r, err := keyRingLocked(sid, false)
+	var dek []byte
+	if err == nil { dek = r.keys[ver] }
+	if err == nil && dek == nil && ver > r.Active {
+		// Server khác vừa xoay khóa -> Nạp lại chuỗi khóa
+		delete(tenantKeys.Rings, sid)
+		if r, err = keyRingLocked(sid, false); err == nil { dek = r.keys[ver] }
+	}
+	tenantKeys.Unlock()
+	if err != nil { return "", err }
+	if dek == nil { return "", fmt.Errorf("Không có khóa v%d", ver) }
+
+	aead, err := newAEAD(dek)
+	if err != nil { return "", err }
+	ns := aead.NonceSize()
+	if len(raw) < ns { return "", fmt.Errorf("Ô mã hóa hỏng") }
+	plain, err := aead.Open(nil, raw[:ns], raw[ns:], []byte(strconv.Itoa(col)))
+	if err != nil { return "", fmt.Errorf("Giải mã thất bại: %v", err) }
+	return string(plain), nil
+}
+
+// sealCellsLocked: Mã hóa các ô nhạy cảm còn ở dạng rõ trong cells (Cập nhật luôn Cache). Yêu cầu giữ SheetMutex (Write).
+func sealCellsLocked(sid string, cache *SheetCacheData, idx int, cells RowCells) {
+	if !cryptoEnabled() { return }
+	for col, val := range cells {
+		s := SafeString(val)
+		if !isSensitiveCol(col) || s == "" || isEncrypted(s) { continue }
+		enc, err := encryptCell(sid, col, s)
+		if err != nil {
+			log.Printf("❌ [CRYPTO] %s: Mã hóa dòng %d cột %d: %v", sid, RANGES.DATA_START_ROW+idx, col, err)
+			continue
+		}
+		setRowCell(cache, idx, col, enc, cells)
+	}
+}
+
+// sealSheet: Mã hóa mọi ô nhạy cảm còn dạng rõ của DataTiktok (Sau khi nạp / hợp nhất Sheet). Trả về số dòng đã đổi.
+func sealSheet(sid string, cache *SheetCacheData) int {
+	if !cryptoEnabled() { return 0 }
+	if err := guardKeyRing(sid, cache); err != nil {
+		log.Printf("❌ [CRYPTO] %s: %v", sid, err)
+		return 0
+	}
+	changed, err := resealSheet(sid, cache,
+		func(s string) bool { return !isEncrypted(s) },
+		func(col int, s string) (string, error) { return encryptCell(sid, col, s) })
+	if err != nil { log.Printf("❌ [CRYPTO] %s: Ghi WAL khi mã hóa: %v", sid, err) }
+	if changed > 0 { fmt.Printf("🔒 [CRYPTO] %s: Mã hóa %d dòng.\n", sid, changed) }
+	return changed
+}
+
+// resealSheet: Ghi lại ô nhạy cảm theo lô ENCRYPTION.BATCH_ROWS dòng. Mỗi lô: Chụp ô cần đổi (RLock) -> Mã hóa ngoài Lock
+// -> Ghi vào Cache nếu ô chưa bị sửa trong lúc đó (Lock) + 1 lần ghi WAL cho cả lô, chờ fsync sau khi nhả Lock.
+func resealSheet(sid string, cache *SheetCacheData, need func(s string) bool, seal func(col int, s string) (string, error)) (int, error) {
+	type cellRef struct {
+		idx, col int
+		old, enc string
+	}
+
+	STATE.SheetMutex.RLock()
+	total := len(cache.RawValues)
+	STATE.SheetMutex.RUnlock()
+
+	changed := 0
+	for start := 0; start < total; start += ENCRYPTION.BATCH_ROWS {
+		end := start + ENCRYPTION.BATCH_ROWS
+		if end > total { end = total }
+
+		var refs []cellRef
+		STATE.SheetMutex.RLock()
+		for idx := start; idx < end && idx < len(cache.RawValues); idx++ {
+			for _, col := range ENCRYPTION.COLUMNS {
+				if s := gs(cache.RawValues[idx], col); s != "" && need(s) { refs = append(refs, cellRef{idx: idx, col: col, old: s}) }
+			}
+		}
+		STATE.SheetMutex.RUnlock()
+		if len(refs) == 0 { continue }
+
+		for i := range refs {
+			enc, err := seal(refs[i].col, refs[i].old)
+			if err != nil {
+				log.Printf("❌ [CRYPTO] %s: Bỏ qua dòng %d cột %d: %v", sid, RANGES.DATA_START_ROW+refs[i].idx, refs[i].col, err)
+				continue
+			}
+			refs[i].enc = enc
+		}
+
+		STATE.SheetMutex.Lock()
+		batch := make(map[int]RowCells)
+		for _, ref := range refs {
+			// Ô vừa bị Handler sửa -> Giữ giá trị mới (Handler tự mã hóa, lần nạp / hợp nhất sau xử lý phần còn lại)
+			if ref.enc == "" || ref.idx >= len(cache.RawValues) || gs(cache.RawValues[ref.idx], ref.col) != ref.old { continue }
+			if batch[ref.idx] == nil { batch[ref.idx] = make(RowCells) }
+			setRowCell(cache, ref.idx, ref.col, ref.enc, batch[ref.idx])
+		}
+		ticket := QueueUpdateRows(sid, SHEET_NAMES.DATA_TIKTOK, batch)
+		STATE.SheetMutex.Unlock()
+		changed += len(batch)
+		if err := ticket.Wait(); err != nil { return changed, err }
+	}
+	return changed, nil
+}
+
+// openRow: Bản sao dòng với các ô nhạy cảm đã giải mã (Chỉ dùng để trả cho Tool đang giữ nick)
+func openRow(sid string, row []interface{}) []interface{} {
+	out := make([]interface{}, len(row))
+	copy(out, row)
+	for _, col := range ENCRYPTION.COLUMNS {
+		if col >= len(out) { continue }
+		s := SafeString(out[col])
+		if !isEncrypted(s) { continue }
+		plain, err := decryptCell(sid, col, s)
+		if err != nil {
+			log.Printf("❌ [CRYPTO] %s: Giải mã cột %d: %v", sid, col, err)
+			plain = ""
+		}
+		out[col] = plain
+	}
+	return out
+}
+
+// profileRow: Dòng dùng dựng Profile trả cho Tool. Chỉ giải mã khi deviceId đang giữ nick, rồi che cột Token không được đọc.
+func profileRow(sid string, row []interface{}, deviceId string, scopes ScopeSet) []interface{} {
+	if deviceId != "" && sameDevice(CleanString(gs(row, INDEX_DATA_TIKTOK.DEVICE_ID)), deviceId) { row = openRow(sid, row) }
+	return maskRow(row, scopes)
+}
+
+// RotateTenantKey: Tạo DEK mới & mã hóa lại toàn bộ DataTiktok qua Write Queue. Trả về phiên bản mới & số dòng đã ghi lại.
+func RotateTenantKey(sid string) (int, int, error) {
+	if !cryptoEnabled() { return 0, 0, fmt.Errorf("Chưa cấu hình DATA_MASTER_KEY") }
+	cache, err := LayDuLieu(sid, SHEET_NAMES.DATA_TIKTOK, false)
+	if err != nil { return 0, 0, fmt.Errorf("Lỗi tải dữ liệu") }
+
+	if err := guardKeyRing(sid, cache); err != nil { return 0, 0, err }
+	tenantKeys.Lock()
+	_, err = keyRingLocked(sid, true)
+	ver := 0
+	if err == nil { ver, err = addKeyLocked(sid) }
+	tenantKeys.Unlock()
+	if err != nil { return 0, 0, err }
+
+	changed, err := resealSheet(sid, cache,
+		func(s string) bool { return cellVersion(s) != ver },
+		func(col int, s string) (string, error) {
+			plain, err := decryptCell(sid, col, s)
+			if err != nil { return "", err }
+			return encryptCell(sid, col, plain)
+		})
+	if err != nil { return ver, changed, fmt.Errorf("Lỗi ghi nhật ký (WAL), thử lại") }
+	fmt.Printf("🔑 [CRYPTO] %s: Xoay sang khóa v%d, mã hóa lại %d dòng.\n", sid, ver, changed)
+	return ver, changed, nil
+}
+
+// EncryptionStatus: Phiên bản khóa & số ô theo từng phiên bản (0 = Chưa mã hóa)
+func EncryptionStatus(sid string) (map[string]interface{}, error) {
+	cache, err := LayDuLieu(sid, SHEET_NAMES.DATA_TIKTOK, false)
+	if err != nil { return nil, fmt.Errorf("Lỗi tải dữ liệu") }
+
+	tenantKeys.Lock()
+	enabled := tenantKeys.Master != nil
+	active, versions := 0, []int{}
+	if enabled {
+		if r, err := keyRingLocked(sid, false); err == nil {
+			active = r.Active
+			for v := range r.Wrapped { versions = append(versions, v) }
+		}
+	}
+	tenantKeys.Unlock()
+
+	cells := make(map[string]int)
+	STATE.SheetMutex.RLock()
+	for _, row := range cache.RawValues {
+		for _, col := range ENCRYPTION.COLUMNS {
+			if s := gs(row, col); s != "" { cells[strconv.Itoa(cellVersion(s))]++ }
+		}
+	}
+	STATE.SheetMutex.RUnlock()
+
+	return map[string]interface{}{"enabled": enabled, "active_version": active, "versions": versions, "cells_by_version": cells}, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memKeyStore: keyStore trong RAM (Thay Firebase khi test)
+type memKeyStore struct {
+	mu    sync.Mutex
+	rings map[string][]byte
+}
+
+func (m *memKeyStore) Load(sid string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rings[sid], nil
+}
+
+func (m *memKeyStore) Update(sid string, fn func(cur []byte) ([]byte, error)) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	next, err := fn(m.rings[sid])
+	if err != nil { return nil, err }
+	m.rings[sid] = next
+	return next, nil
+}
+
+// resetCryptoForTest: Khóa gốc cố định + keyStore RAM + Queue / WAL tạm
+func resetCryptoForTest(t *testing.T) *memKeyStore {
+	t.Helper()
+	resetQueueForTest(t)
+	aead, err := newAEAD([]byte(strings.Repeat("k", 32)))
+	if err != nil { t.Fatal(err) }
+	store := &memKeyStore{rings: make(map[string][]byte)}
+	oldStore := keyStore
+	keyStore = store
+	tenantKeys.Lock()
+	tenantKeys.Master = aead
+	tenantKeys.Rings = make(map[string]*keyRing)
+	tenantKeys.Sealed = make(map[string]bool)
+	tenantKeys.Unlock()
+	t.Cleanup(func() {
+		keyStore = oldStore
+		tenantKeys.Lock()
+		tenantKeys.Master = nil
+		tenantKeys.Rings = make(map[string]*keyRing)
+		tenantKeys.Sealed = make(map[string]bool)
+		tenantKeys.Unlock()
+	})
+	return store
+}
+
+// restartCrypto: Giả lập Restart (Xóa chuỗi khóa trong RAM, keyStore giữ nguyên)
+func restartCrypto() {
+	tenantKeys.Lock()
+	tenantKeys.Rings = make(map[string]*keyRing)
+	tenantKeys.Sealed = make(map[string]bool)
+	tenantKeys.Unlock()
+}
+
+// cachedDataSheet: Đặt DataTiktok vào Cache (LayDuLieu trả thẳng, không đọc Store)
+func cachedDataSheet(t *testing.T, sid string, rows [][]interface{}) *SheetCacheData {
+	t.Helper()
+	cache := buildSheetCache(SHEET_NAMES.DATA_TIKTOK, rows)
+	cache.Timestamp = time.Now().UnixMilli()
+	cache.TTL = time.Hour.Milliseconds()
+	key := sid + KEY_SEPARATOR + SHEET_NAMES.DATA_TIKTOK
+	STATE.SheetMutex.Lock()
+	STATE.SheetCache[key] = cache
+	STATE.SheetMutex.Unlock()
+	t.Cleanup(func() { STATE.SheetMutex.Lock(); delete(STATE.SheetCache, key); STATE.SheetMutex.Unlock() })
+	return cache
+}
+
+func sensitiveRow(pass, cookie string) []interface{} {
+	row := make([]interface{}, INDEX_DATA_TIKTOK.COOKIE+1)
+	for i := range row { row[i] = "" }
+	row[INDEX_DATA_TIKTOK.PASSWORD] = pass
+	row[INDEX_DATA_TIKTOK.COOKIE] = cookie
+	return row
+}
+
+func TestCellRoundTrip(t *testing.T) {
+	resetCryptoForTest(t)
+	for _, plain := range []string{"pass@123", "mật khẩu có dấu", "otpauth://totp/a?secret=JBSWY3DP", strings.Repeat("c", 4096), "enc:v1:giả"} {
+		enc, err := encryptCell("s", INDEX_DATA_TIKTOK.PASSWORD, plain)
+		if err != nil { t.Fatal(err) }
+		if _, payload := splitCell(enc); payload == "" || strings.Contains(payload, plain) { t.Fatalf("%q: bản mã lộ giá trị rõ: %s", plain, enc) }
+		got, err := decryptCell("s", INDEX_DATA_TIKTOK.PASSWORD, enc)
+		if err != nil || got != plain { t.Fatalf("%q: giải mã = %q, %v", plain, got, err) }
+	}
+	if got, _ := decryptCell("s", INDEX_DATA_TIKTOK.PASSWORD, "rõ"); got != "rõ" { t.Fatalf("giá trị rõ phải trả nguyên văn: %q", got) }
+}
+
+func TestCellTampered(t *testing.T) {
+	resetCryptoForTest(t)
+	col := INDEX_DATA_TIKTOK.PASSWORD
+	enc, err := encryptCell("s", col, "secret")
+	if err != nil { t.Fatal(err) }
+	ver, payload := splitCell(enc)
+	raw, _ := base64.RawURLEncoding.DecodeString(payload)
+	flip := func(i int) string {
+		b := append([]byte(nil), raw...)
+		b[i] ^= 1
+		return ENCRYPTION.PREFIX + "1:" + base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	tests := []struct {
+		name string
+		sid  string
+		col  int
+		val  string
+	}{
+		{"sửa 1 bit nonce", "s", col, flip(0)},
+		{"sửa 1 bit bản mã", "s", col, flip(len(raw) / 2)},
+		{"sửa 1 bit tag", "s", col, flip(len(raw) - 1)},
+		{"tráo sang cột khác (AAD)", "s", INDEX_DATA_TIKTOK.COOKIE, enc},
+		{"Tenant khác", "other", col, enc},
+		{"phiên bản không tồn tại", "s", col, ENCRYPTION.PREFIX + "9:" + payload},
+		{"Base64 hỏng", "s", col, ENCRYPTION.PREFIX + "1:!!!"},
+		{"cắt ngắn", "s", col, ENCRYPTION.PREFIX + "1:" + base64.RawURLEncoding.EncodeToString(raw[:4])},
+		{"thiếu phiên bản", "s", col, ENCRYPTION.PREFIX + ":" + payload},
+	}
+	if ver != 1 { t.Fatalf("phiên bản đầu = %d, want 1", ver) }
+	encryptCell("other", col, "x") // Tenant khác có chuỗi khóa riêng
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := decryptCell(tc.sid, tc.col, tc.val); err == nil { t.Fatalf("phải lỗi, got %q", got) }
+		})
+	}
+}
+
+func TestRotateAcrossVersions(t *testing.T) {
+	store := resetCryptoForTest(t)
+	col := INDEX_DATA_TIKTOK.COOKIE
+	v1, _ := encryptCell("s", col, "c1")
+	cache := cachedDataSheet(t, "s", [][]interface{}{sensitiveRow("p0", ""), sensitiveRow("", v1)})
+
+	// Dòng 0 còn dạng rõ -> Mã hóa bằng v1
+	if n := sealSheet("s", cache); n != 1 { t.Fatalf("sealSheet = %d, want 1", n) }
+
+	ver, n, err := RotateTenantKey("s")
+	if err != nil || ver != 2 || n != 2 { t.Fatalf("rotate = v%d, %d dòng, %v", ver, n, err) }
+	for idx, want := range map[int][2]string{0: {"p0", ""}, 1: {"", "c1"}} {
+		for i, c := range []int{INDEX_DATA_TIKTOK.PASSWORD, col} {
+			s := gs(cache.RawValues[idx], c)
+			if want[i] == "" { continue }
+			if cellVersion(s) != 2 { t.Fatalf("dòng %d cột %d: phiên bản %d, want 2", idx, c, cellVersion(s)) }
+			if got, _ := decryptCell("s", c, s); got != want[i] { t.Fatalf("dòng %d cột %d = %q", idx, c, got) }
+		}
+	}
+
+	// Restart: Nạp lại từ keyStore -> Bản mã v1 (Chưa kịp ghi lại) vẫn đọc được, ô mới dùng v2
+	restartCrypto()
+	if got, err := decryptCell("s", col, v1); err != nil || got != "c1" { t.Fatalf("v1 sau restart = %q, %v", got, err) }
+	if enc, _ := encryptCell("s", col, "c2"); cellVersion(enc) != 2 { t.Fatalf("ô mới phải dùng v2: %s", enc) }
+
+	// Server khác xoay sang v3 -> Server này (Còn chuỗi khóa cũ) gặp ô v3 thì tự nạp lại
+	tenantKeys.Lock()
+	stale := tenantKeys.Rings["s"]
+	addKeyLocked("s")
+	tenantKeys.Unlock()
+	enc3, _ := encryptCell("s", col, "c3")
+	tenantKeys.Lock()
+	tenantKeys.Rings["s"] = stale
+	tenantKeys.Unlock()
+	if got, err := decryptCell("s", col, enc3); err != nil || got != "c3" || cellVersion(enc3) != 3 { t.Fatalf("v3 = %q, %v (%s)", got, err, enc3) }
+	if len(store.rings) != 1 { t.Fatalf("keyStore = %d Tenant, want 1", len(store.rings)) }
+}
+
+func TestKeyRingLostFailsClosed(t *testing.T) {
+	tests := []struct {
+		name   string
+		rows   [][]interface{}
+		master string // Khác rỗng -> Khóa gốc bị đổi sau khi mã hóa
+		lost   bool   // Xóa chuỗi khóa trong keyStore
+	}{
+		{"mất chuỗi khóa", [][]interface{}{sensitiveRow("p", "")}, "", true},
+		{"sai khóa gốc", [][]interface{}{sensitiveRow("p", "")}, strings.Repeat("x", 32), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := resetCryptoForTest(t)
+			enc, _ := encryptCell("s", INDEX_DATA_TIKTOK.COOKIE, "c")
+			before := string(store.rings["s"])
+			restartCrypto()
+			if tc.lost { delete(store.rings, "s") }
+			if tc.master != "" {
+				aead, _ := newAEAD([]byte(tc.master))
+				tenantKeys.Lock()
+				tenantKeys.Master = aead
+				tenantKeys.Unlock()
+			}
+
+			rows := append(tc.rows, sensitiveRow("", enc))
+			cache := cachedDataSheet(t, "s", rows)
+			if n := sealSheet("s", cache); n != 0 { t.Fatalf("sealSheet = %d, want 0", n) }
+			if gs(cache.RawValues[0], INDEX_DATA_TIKTOK.PASSWORD) != "p" { t.Fatal("ô rõ không được mã hóa bằng khóa mới") }
+			if _, err := encryptCell("s", INDEX_DATA_TIKTOK.PASSWORD, "p"); err == nil { t.Fatal("encryptCell phải lỗi") }
+			if _, _, err := RotateTenantKey("s"); err == nil { t.Fatal("RotateTenantKey phải lỗi") }
+			if tc.lost && store.rings["s"] != nil { t.Fatal("không được tạo chuỗi khóa mới") }
+			if !tc.lost && string(store.rings["s"]) != before { t.Fatal("chuỗi khóa cũ bị ghi đè") }
+		})
+	}
+}
+
+func TestResealSkipsConcurrentEdit(t *testing.T) {
+	resetCryptoForTest(t)
+	cache := cachedDataSheet(t, "s", [][]interface{}{sensitiveRow("p", "")})
+	n, err := resealSheet("s", cache,
+		func(s string) bool { return !isEncrypted(s) },
+		func(col int, s string) (string, error) {
+			// Handler ghi giá trị mới trong lúc đang mã hóa ngoài Lock
+			STATE.SheetMutex.Lock()
+			cache.RawValues[0][col] = "new"
+			STATE.SheetMutex.Unlock()
+			return encryptCell("s", col, s)
+		})
+	if err != nil || n != 0 { t.Fatalf("reseal = %d, %v", n, err) }
+	if got := gs(cache.RawValues[0], INDEX_DATA_TIKTOK.PASSWORD); got != "new" { t.Fatalf("ô bị đè = %q", got) }
+}
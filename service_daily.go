@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =================================================================================================
+// 🌙 RESET HẰNG NGÀY (TODAY_* COUNT, LAST_ACTIVE_DATE, SỐ LẦN CHẠY TRONG NOTE)
+// =================================================================================================
+// - Thay Apps Script chạy lúc 0h: Mỗi DAILY_RESET.CHECK_MS kiểm tra từng DataTiktok đang Cache,
+//   sang ngày mới (Theo múi giờ Tenant) -> Quét & reset.
+// - Múi giờ Tenant: Trường "timezone" trong Token Firebase ("Asia/Bangkok", "+7", "UTC+7").
+//   Không có -> DAILY_RESET.DEFAULT_OFFSET (Giờ VN).
+// - Chỉ reset khi thật sự sang ngày: Mốc ngày reset gần nhất của Tenant lưu ở <WAL_DIR>/daily/<SafeIdent(sid)>.json
+//   (Sống qua Restart). Chưa có mốc (Lần đầu chạy) -> Chỉ ghi mốc hôm nay, không reset.
+// - Sang ngày -> Đưa mọi TODAY_* khác 0 về 0 (Không dựa vào LAST_ACTIVE_DATE). Không ghi vào LAST_ACTIVE_DATE.
+// - Idempotent: Chỉ đụng dòng còn số khác 0 -> Chạy lại giữa chừng (Restart trước khi kịp lưu mốc) không hỏng dữ liệu.
+// - Ghi qua Write Queue theo lô DAILY_RESET.BATCH_ROWS dòng, nghỉ giữa các lô để Handler không phải chờ Lock lâu.
+
+var tenantZones = struct {
+	sync.RWMutex
+	Zones     map[string]*time.Location // sid -> Múi giờ
+	Raw       map[string]string         // sid -> Chuỗi "timezone" gốc (Đổi trên Firebase -> Nạp lại)
+	LastReset map[string]string         // sid -> Ngày (dd/MM/yyyy) đã reset gần nhất (Bản RAM của file daily/)
+}{
+	Zones:     make(map[string]*time.Location),
+	Raw:       make(map[string]string),
+	LastReset: make(map[string]string),
+}
+
+// rememberTenantZone: Ghi nhận múi giờ từ Token (Gọi trong AuthMiddleware)
+func rememberTenantZone(sid string, data map[string]interface{}) {
+	raw := SafeString(data["timezone"])
+	if raw == "" { return }
+
+	tenantZones.RLock()
+	known := tenantZones.Raw[sid] == raw
+	tenantZones.RUnlock()
+	if known { return }
+
+	loc := parseTimezone(raw)
+	if loc == nil {
+		log.Printf("⚠️ [DAILY] %s: Timezone không hợp lệ (%s) -> Dùng mặc định", sid, raw)
+		return
+	}
+	tenantZones.Lock()
+	tenantZones.Zones[sid] = loc
+	tenantZones.Raw[sid] = raw
+	tenantZones.Unlock()
+}
+
+// parseTimezone: "Asia/Bangkok" | "+7" | "UTC+7" | "GMT-3:30"
+func parseTimezone(raw string) *time.Location {
+	if loc, err := time.LoadLocation(raw); err == nil { return loc }
+
+	s := strings.TrimPrefix(strings.TrimPrefix(strings.ToUpper(raw), "UTC"), "GMT")
+	if s == "" { return time.UTC }
+	sign := 1
+	if s[0] == '-' { sign = -1 }
+	s = strings.TrimLeft(s, "+-")
+	parts := strings.SplitN(s, ":", 2)
+	h, err := strconv.Atoi(parts[0])
+	if err != nil || h > 14 { return nil }
+	m := 0
+	if len(parts) == 2 {
+		if m, err = strconv.Atoi(parts[1]); err != nil || m >= 60 { return nil }
+	}
+	return time.FixedZone(raw, sign*(h*3600+m*60))
+}
+
+// tenantNow: Giờ hiện tại theo múi giờ Tenant
+func tenantNow(sid string) time.Time {
+	tenantZones.RLock()
+	loc, ok := tenantZones.Zones[sid]
+	tenantZones.RUnlock()
+	if !ok { loc = time.FixedZone("UTC+7", DAILY_RESET.DEFAULT_OFFSET) }
+	return time.Now().In(loc)
+}
+
+// RunDailyReset: Chạy nền (main.go)
+func RunDailyReset() {
+	ticker := time.NewTicker(time.Duration(DAILY_RESET.CHECK_MS) * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		suffix := KEY_SEPARATOR + SHEET_NAMES.DATA_TIKTOK
+		var sids []string
+		STATE.SheetMutex.RLock()
+		for k := range STATE.SheetCache {
+			if strings.HasSuffix(k, suffix) { sids = append(sids, strings.TrimSuffix(k, suffix)) }
+		}
+		STATE.SheetMutex.RUnlock()
+
+		for _, sid := range sids { checkDailyReset(sid) }
+	}
+}
+
+// checkDailyReset: Sang ngày so với mốc đã lưu -> Reset rồi lưu mốc mới
+func checkDailyReset(sid string) {
+	today := quotaToday(sid)
+	last := lastResetDate(sid)
+	if last == today { return }
+
+	if rollover(last, today) {
+		n := resetDailyCounters(sid, today)
+		if n > 0 { fmt.Printf("🌙 [DAILY] %s: Reset %d dòng cho ngày %s.\n", sid, n, today) }
+	}
+	if err := saveResetDate(sid, today); err != nil { log.Printf("❌ [DAILY] Lưu mốc reset %s: %v", sid, err) }
+}
+
+// rollover: Mốc cũ là ngày trước hôm nay. Chưa có mốc / Mốc hỏng / Đồng hồ lùi -> false
+func rollover(last, today string) bool {
+	a, err1 := time.Parse("02/01/2006", last)
+	b, err2 := time.Parse("02/01/2006", today)
+	return err1 == nil && err2 == nil && a.Before(b)
+}
+
+type dailyRecord struct {
+	LastReset string `json:"last_reset"` // dd/MM/yyyy theo múi giờ Tenant
+}
+
+func dailyRecordPath(sid string) string {
+	return filepath.Join(journalDir(), "daily", SafeIdent(sid)+".json")
+}
+
+// lastResetDate: Mốc reset gần nhất (Nạp từ đĩa lần đầu). "" = Chưa có
+func lastResetDate(sid string) string {
+	tenantZones.RLock()
+	last, ok := tenantZones.LastReset[sid]
+	tenantZones.RUnlock()
+	if ok { return last }
+
+	var rec dailyRecord
+	if raw, err := os.ReadFile(dailyRecordPath(sid)); err == nil {
+		if err := json.Unmarshal(raw, &rec); err != nil { log.Printf("❌ [DAILY] Đọc %s: %v", sid, err) }
+	}
+	tenantZones.Lock()
+	tenantZones.LastReset[sid] = rec.LastReset
+	tenantZones.Unlock()
+	return rec.LastReset
+}
+
+// saveResetDate: Ghi mốc xuống đĩa (tmp + rename) rồi cập nhật RAM. Lỗi đĩa -> Giữ mốc RAM để không reset lặp trong phiên này.
+func saveResetDate(sid, date string) error {
+	tenantZones.Lock()
+	tenantZones.LastReset[sid] = date
+	tenantZones.Unlock()
+
+	path := dailyRecordPath(sid)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return err }
+	raw, _ := json.Marshal(dailyRecord{LastReset: date})
+	if err := os.WriteFile(path+".tmp", raw, 0o644); err != nil { return err }
+	return os.Rename(path+".tmp", path)
+}
+
+// resetDailyCounters: Reset các dòng còn số liệu của ngày cũ. Trả về số dòng đã đổi.
+func resetDailyCounters(sid, today string) int {
+	STATE.SheetMutex.RLock()
+	cache, ok := STATE.SheetCache[sid+KEY_SEPARATOR+SHEET_NAMES.DATA_TIKTOK]
+	total := 0
+	if ok { total = len(cache.RawValues) }
+	STATE.SheetMutex.RUnlock()
+	if !ok { return 0 }
+
+	changed := 0
+	for start := 0; start < total; start += DAILY_RESET.BATCH_ROWS {
+		end := start + DAILY_RESET.BATCH_ROWS
+		if end > total { end = total }
+
+		STATE.SheetMutex.Lock()
+		batch := make(map[int]RowCells)
+		for idx := start; idx < end && idx < len(cache.RawValues); idx++ {
+			if dirty := resetRowLocked(cache, idx, today); len(dirty) > 0 {
+				batch[idx] = dirty
+				changed++
+			}
+		}
+		ticket := QueueUpdateRows(sid, SHEET_NAMES.DATA_TIKTOK, batch) // 1 lần ghi WAL cho cả lô
+		STATE.SheetMutex.Unlock()
+		ticket.Wait()
+
+		if end < total { time.Sleep(time.Duration(DAILY_RESET.BATCH_PAUSE_MS) * time.Millisecond) }
+	}
+	return changed
+}
+
+// resetRowLocked: Reset 1 dòng lúc sang ngày. Yêu cầu giữ SheetMutex (Write).
+func resetRowLocked(cache *SheetCacheData, idx int, today string) RowCells {
+	row := cache.RawValues[idx]
+	dirty := make(RowCells)
+
+	// 1. Bộ đếm hoạt động -> 0. KHÔNG đụng LAST_ACTIVE_DATE (Là mốc hoạt động thật, Xoay vòng LRU sắp theo cột này)
+	for _, col := range []int{INDEX_DATA_TIKTOK.TODAY_POST_COUNT, INDEX_DATA_TIKTOK.TODAY_FOLLOW_COUNT} {
+		if v, ok := getFloatVal(row, col); ok && v != 0 { setRowCell(cache, idx, col, float64(0), dirty) }
+	}
+
+	// 2. "(Lần N)" của ngày cũ trong Note -> "(Lần 0)"
+	note := gs(row, INDEX_DATA_TIKTOK.NOTE)
+	if m := REGEX_COUNT.FindStringSubmatch(note); len(m) > 1 && m[1] != "0" {
+		if REGEX_DATE.FindString(note) != today {
+			setRowCell(cache, idx, INDEX_DATA_TIKTOK.NOTE, REGEX_COUNT.ReplaceAllString(note, "(Lần 0)"), dirty)
+		}
+	}
+	return dirty
+}
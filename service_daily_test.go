@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+// countRow: Dòng DataTiktok có TODAY_* & LAST_ACTIVE_DATE
+func countRow(post, follow float64, lastActive string) []interface{} {
+	row := make([]interface{}, INDEX_DATA_TIKTOK.LAST_ACTIVE_DATE+1)
+	for i := range row { row[i] = "" }
+	row[INDEX_DATA_TIKTOK.TODAY_POST_COUNT] = post
+	row[INDEX_DATA_TIKTOK.TODAY_FOLLOW_COUNT] = follow
+	row[INDEX_DATA_TIKTOK.LAST_ACTIVE_DATE] = lastActive
+	return row
+}
+
+// forgetResetDate: Giả lập Restart (Xóa mốc trong RAM, file daily/ giữ nguyên)
+func forgetResetDate(sid string) {
+	tenantZones.Lock()
+	delete(tenantZones.LastReset, sid)
+	tenantZones.Unlock()
+}
+
+func TestDailyResetOnlyOnRollover(t *testing.T) {
+	today := quotaToday("s")
+	yesterday := tenantNow("s").AddDate(0, 0, -1).Format("02/01/2006")
+	tests := []struct {
+		name   string
+		stored string // Mốc đã lưu trên đĩa ("" = Chưa có)
+		row    []interface{}
+		reset  bool
+	}{
+		{"lần đầu chạy: chỉ ghi mốc", "", countRow(3, 4, yesterday), false},
+		{"đã reset hôm nay (Restart)", today, countRow(3, 4, yesterday), false},
+		{"sang ngày: reset", yesterday, countRow(3, 4, yesterday), true},
+		{"sang ngày: reset dù LAST_ACTIVE_DATE là hôm nay", yesterday, countRow(3, 4, today), true},
+		{"mốc ở tương lai (Đồng hồ lùi)", tenantNow("s").AddDate(0, 0, 1).Format("02/01/2006"), countRow(3, 4, yesterday), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resetQueueForTest(t)
+			forgetResetDate("s")
+			t.Cleanup(func() { forgetResetDate("s") })
+			if tc.stored != "" {
+				if err := saveResetDate("s", tc.stored); err != nil { t.Fatal(err) }
+				forgetResetDate("s")
+			}
+			cache := cachedDataSheet(t, "s", [][]interface{}{tc.row})
+
+			checkDailyReset("s")
+			post, _ := getFloatVal(cache.RawValues[0], INDEX_DATA_TIKTOK.TODAY_POST_COUNT)
+			follow, _ := getFloatVal(cache.RawValues[0], INDEX_DATA_TIKTOK.TODAY_FOLLOW_COUNT)
+			if got := post == 0 && follow == 0; got != tc.reset { t.Fatalf("reset = %v (post %v, follow %v), want %v", got, post, follow, tc.reset) }
+			if gs(cache.RawValues[0], INDEX_DATA_TIKTOK.LAST_ACTIVE_DATE) != gs(tc.row, INDEX_DATA_TIKTOK.LAST_ACTIVE_DATE) { t.Fatal("không được đụng LAST_ACTIVE_DATE") }
+
+			// Mốc đã lưu xuống đĩa -> Restart không reset lại
+			forgetResetDate("s")
+			if last := lastResetDate("s"); last != today { t.Fatalf("mốc sau Restart = %q, want %q", last, today) }
+			setRowCell(cache, 0, INDEX_DATA_TIKTOK.TODAY_POST_COUNT, float64(7), make(RowCells))
+			checkDailyReset("s")
+			if v, _ := getFloatVal(cache.RawValues[0], INDEX_DATA_TIKTOK.TODAY_POST_COUNT); v != 7 { t.Fatalf("reset lặp sau Restart: post = %v", v) }
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// =================================================================================================
+// ☠️ DEAD-LETTER STORE (CÁC BATCH GHI THẤT BẠI VĨNH VIỄN)
+// =================================================================================================
+// - FlushQueue chuyển Batch vào đây khi gặp lỗi vĩnh viễn hoặc đã thử lại QUEUE.MAX_RETRY lần.
+// - Lưu xuống đĩa (<WAL_DIR>/deadletter/<SafeIdent(sid)>.json) để xem lại sau Restart.
+// - Quản lý qua API /tool/dead-letter: list / replay / discard.
+
+type DeadLetterEntry struct {
+	ID       string           `json:"id"`
+	Sheet    string           `json:"sheet"`
+	Op       string           `json:"op"` // "update" | "append"
+	Updates  map[int]RowCells `json:"updates,omitempty"` // Row -> Các ô cần ghi
+	Rows     [][]interface{}  `json:"rows,omitempty"`
+	Error    string           `json:"error"`
+	Attempts int              `json:"attempts"`
+	FailedAt string           `json:"failed_at"`
+}
+
+var deadLetters = struct {
+	sync.Mutex
+	Loaded  map[string]bool
+	Entries map[string][]DeadLetterEntry // sid -> Entries
+	Seq     int64
+}{
+	Loaded:  make(map[string]bool),
+	Entries: make(map[string][]DeadLetterEntry),
+}
+
+func deadLetterPath(sid string) string {
+	return filepath.Join(journalDir(), "deadletter", SafeIdent(sid)+".json")
+}
+
+// loadDeadLettersLocked: Nạp từ đĩa lần đầu truy cập sid. Yêu cầu đang giữ deadLetters.
+func loadDeadLettersLocked(sid string) {
+	if deadLetters.Loaded[sid] { return }
+	deadLetters.Loaded[sid] = true
+	b, err := os.ReadFile(deadLetterPath(sid))
+	if err != nil { return }
+	var list []DeadLetterEntry
+	if err := json.Unmarshal(b, &list); err != nil {
+		log.Printf("❌ [DEAD-LETTER] Đọc %s: %v", sid, err)
+		return
+	}
+	deadLetters.Entries[sid] = list
+}
+
+// saveDeadLettersLocked: Ghi đè file của sid (Atomic). Yêu cầu đang giữ deadLetters.
+func saveDeadLettersLocked(sid string) {
+	path := deadLetterPath(sid)
+	list := deadLetters.Entries[sid]
+	if len(list) == 0 {
+		os.Remove(path)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Printf("❌ [DEAD-LETTER] Mkdir: %v", err)
+		return
+	}
+	b, _ := json.Marshal(list)
+	err := os.WriteFile(path+".tmp", b, 0o644)
+	if err == nil { err = os.Rename(path+".tmp", path) }
+	if err != nil { log.Printf("❌ [DEAD-LETTER] Ghi %s: %v", sid, err) }
+}
+
+func addDeadLetter(sid string, e DeadLetterEntry) {
+	deadLetters.Lock()
+	defer deadLetters.Unlock()
+
+	loadDeadLettersLocked(sid)
+	deadLetters.Seq++
+	e.ID = fmt.Sprintf("%d-%d", time.Now().UnixMilli(), deadLetters.Seq)
+	e.FailedAt = time.Now().Format("02/01/2006 15:04:05")
+	deadLetters.Entries[sid] = append(deadLetters.Entries[sid], e)
+	saveDeadLettersLocked(sid)
+	log.Printf("☠️ [DEAD-LETTER] %s / %s (%s) -> %s", sid, e.Sheet, e.Op, e.Error)
+}
+
+func ListDeadLetters(sid string) []DeadLetterEntry {
+	deadLetters.Lock()
+	defer deadLetters.Unlock()
+
+	loadDeadLettersLocked(sid)
+	out := make([]DeadLetterEntry, len(deadLetters.Entries[sid]))
+	copy(out, deadLetters.Entries[sid])
+	return out
+}
+
+// TakeDeadLetters: Lấy ra (và xóa khỏi Store) các Entry theo ID. ids rỗng = Tất cả.
+func TakeDeadLetters(sid string, ids []string) []DeadLetterEntry {
+	deadLetters.Lock()
+	defer deadLetters.Unlock()
+
+	loadDeadLettersLocked(sid)
+	want := make(map[string]bool)
+	for _, id := range ids { want[id] = true }
+
+	var taken, kept []DeadLetterEntry
+	for _, e := range deadLetters.Entries[sid] {
+		if len(want) == 0 || want[e.ID] { taken = append(taken, e) } else { kept = append(kept, e) }
+	}
+	deadLetters.Entries[sid] = kept
+	if len(taken) > 0 { saveDeadLettersLocked(sid) }
+	return taken
+}
+
+// restoreDeadLetters: Trả các Entry (Giữ nguyên ID) về đầu danh sách của sid
+func restoreDeadLetters(sid string, entries []DeadLetterEntry) {
+	if len(entries) == 0 { return }
+	deadLetters.Lock()
+	defer deadLetters.Unlock()
+
+	loadDeadLettersLocked(sid)
+	deadLetters.Entries[sid] = append(append([]DeadLetterEntry{}, entries...), deadLetters.Entries[sid]...)
+	saveDeadLettersLocked(sid)
+}
+
+// ReplayDeadLetters: Đưa các Entry trở lại Write Queue để ghi lại. Trả về số Entry đã vào WAL.
+// - Từng Entry chờ WAL fsync xong mới sang Entry kế. Ghi WAL lỗi -> Entry đó & phần còn lại quay về Dead-letter.
+// Lưu ý: Dữ liệu là bản chụp lúc lỗi, sẽ ghi đè lên các ô tương ứng trên Sheet.
+func ReplayDeadLetters(sid string, ids []string) (int, error) {
+	entries := TakeDeadLetters(sid, ids)
+	for i, e := range entries {
+		var ticket journalTicket
+		if e.Op == "append" {
+			ticket = QueueAppend(sid, e.Sheet, e.Rows)
+		} else {
+			ticket = QueueUpdateRows(sid, e.Sheet, e.Updates)
+		}
+		if err := ticket.Wait(); err != nil {
+			restoreDeadLetters(sid, entries[i:])
+			log.Printf("❌ [DEAD-LETTER] %s: Replay dừng ở %s: %v", sid, e.ID, err)
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
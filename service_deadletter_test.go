@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/lib/pq"
+	"google.golang.org/api/googleapi"
+)
+
+func TestReplayDeadLettersKeepsEntriesOnWALError(t *testing.T) {
+	resetQueueForTest(t)
+	deadLetters.Lock()
+	deadLetters.Loaded = make(map[string]bool)
+	deadLetters.Entries = make(map[string][]DeadLetterEntry)
+	deadLetters.Unlock()
+
+	addDeadLetter("s", DeadLetterEntry{Sheet: "Log", Op: "append", Rows: [][]interface{}{{"a"}}})
+	addDeadLetter("s", DeadLetterEntry{Sheet: "Data", Op: "update", Updates: map[int]RowCells{1: {0: "x"}}})
+	before := ListDeadLetters("s")
+
+	// Đường dẫn WAL là thư mục -> Mở file lỗi
+	if err := os.MkdirAll(journalPath("s"), 0o755); err != nil { t.Fatal(err) }
+	n, err := ReplayDeadLetters("s", nil)
+	if err == nil || n != 0 { t.Fatalf("replay = %d, %v", n, err) }
+	after := ListDeadLetters("s")
+	if len(after) != len(before) || after[0].ID != before[0].ID || after[1].ID != before[1].ID { t.Fatalf("entries = %+v, want %+v", after, before) }
+
+	// WAL ghi được -> Lấy hết khỏi Dead-letter
+	os.Remove(journalPath("s"))
+	if n, err := ReplayDeadLetters("s", nil); err != nil || n != 2 { t.Fatalf("replay = %d, %v", n, err) }
+	if left := ListDeadLetters("s"); len(left) != 0 { t.Fatalf("còn %d entry", len(left)) }
+}
+
+func TestIsRetryableStoreError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Range sai", &PermanentStoreError{"x"}, false},
+		{"Google 429", &googleapi.Error{Code: 429}, true},
+		{"Google 503", &googleapi.Error{Code: 503}, true},
+		{"Google 400", &googleapi.Error{Code: 400}, false},
+		{"Google 403", fmt.Errorf("wrap: %w", &googleapi.Error{Code: 403}), false},
+		{"mạng", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{"reset", fmt.Errorf("write: %w", syscall.ECONNRESET), true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"Postgres mất kết nối", &pq.Error{Code: "08006"}, true},
+		{"Postgres deadlock", &pq.Error{Code: "40P01"}, true},
+		{"Postgres sai cú pháp", &pq.Error{Code: "42601"}, false},
+		{"SQLite bận", errors.New("database is locked (5) (SQLITE_BUSY)"), true},
+		{"lỗi lạ", errors.New("boom"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetryableStoreError(tc.err); got != tc.want { t.Fatalf("= %v, want %v", got, tc.want) }
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =================================================================================================
+// 📟 SỔ THIẾT BỊ (DEVICE REGISTRY)
+// =================================================================================================
+// - Tự ghi nhận từ mọi Request đã xác thực có "deviceId" (AuthMiddleware): Lần đầu / lần cuối thấy, App version.
+// - Operator gán Group / Tag qua /tool/devices. Group có thể kèm bộ lọc nick (search_and / search_or):
+//   Thiết bị thuộc Group chỉ được cấp nick khớp bộ lọc đó.
+// - Lưu theo Tenant: <WAL_DIR>/devices/<SafeIdent(sid)>.json. Ghi xuống đĩa định kỳ (DEVICES.SAVE_MS).
+
+type DeviceInfo struct {
+	DeviceId   string   `json:"device_id"`
+	FirstSeen  int64    `json:"first_seen"`
+	LastSeen   int64    `json:"last_seen"`
+	AppVersion string   `json:"app_version,omitempty"`
+	Group      string   `json:"group,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// DeviceGroup: Bộ lọc nick áp cho thiết bị trong Group (Cú pháp giống Body /tool/login)
+type DeviceGroup struct {
+	SearchAnd map[string]interface{} `json:"search_and,omitempty"`
+	SearchOr  map[string]interface{} `json:"search_or,omitempty"`
+}
+
+type deviceBook struct {
+	Devices map[string]*DeviceInfo  `json:"devices"`
+	Groups  map[string]*DeviceGroup `json:"groups"`
+}
+
+var devices = struct {
+	sync.Mutex
+	Books map[string]*deviceBook // sid -> Sổ
+	Dirty map[string]bool        // sid -> Cần ghi xuống đĩa
+}{
+	Books: make(map[string]*deviceBook),
+	Dirty: make(map[string]bool),
+}
+
+func deviceBookPath(sid string) string {
+	return filepath.Join(journalDir(), "devices", SafeIdent(sid)+".json")
+}
+
+// deviceBookLocked: Lấy sổ của sid (Nạp từ đĩa lần đầu). Yêu cầu đang giữ devices.
+func deviceBookLocked(sid string) *deviceBook {
+	if b, ok := devices.Books[sid]; ok { return b }
+	b := &deviceBook{}
+	if raw, err := os.ReadFile(deviceBookPath(sid)); err == nil {
+		if err := json.Unmarshal(raw, b); err != nil { log.Printf("❌ [DEVICE] Đọc %s: %v", sid, err) }
+	}
+	if b.Devices == nil { b.Devices = make(map[string]*DeviceInfo) }
+	if b.Groups == nil { b.Groups = make(map[string]*DeviceGroup) }
+	devices.Books[sid] = b
+	return b
+}
+
+// TouchDevice: Ghi nhận thiết bị vừa gửi Request (Gọi trong AuthMiddleware)
+func TouchDevice(sid, deviceId, appVersion string) {
+	dev := baseDevice(CleanString(deviceId))
+	if sid == "" || dev == "" { return }
+	now := time.Now().UnixMilli()
+
+	devices.Lock()
+	defer devices.Unlock()
+
+	b := deviceBookLocked(sid)
+	d, ok := b.Devices[dev]
+	if !ok {
+		if len(b.Devices) >= DEVICES.MAX_PER_TENANT { return }
+		d = &DeviceInfo{DeviceId: dev, FirstSeen: now}
+		b.Devices[dev] = d
+	}
+	d.LastSeen = now
+	if appVersion != "" { d.AppVersion = appVersion }
+	devices.Dirty[sid] = true
+}
+
+// RunDeviceSaver: Chạy nền (main.go). Ghi các sổ đã đổi xuống đĩa.
+func RunDeviceSaver() {
+	ticker := time.NewTicker(time.Duration(DEVICES.SAVE_MS) * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C { SaveDevices() }
+}
+
+// SaveDevices: Ghi ngay các sổ đang bẩn (Gọi thêm lúc Shutdown)
+func SaveDevices() {
+	devices.Lock()
+	defer devices.Unlock()
+
+	for sid := range devices.Dirty {
+		path := deviceBookPath(sid)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			log.Printf("❌ [DEVICE] Mkdir: %v", err)
+			return
+		}
+		raw, _ := json.Marshal(devices.Books[sid])
+		err := os.WriteFile(path+".tmp", raw, 0o644)
+		if err == nil { err = os.Rename(path+".tmp", path) }
+		if err != nil {
+			log.Printf("❌ [DEVICE] Ghi %s: %v", sid, err)
+			continue
+		}
+		delete(devices.Dirty, sid)
+	}
+}
+
+// DeviceAccount: Nick thiết bị đang giữ (Tính từ Cache lúc xem)
+type DeviceAccount struct {
+	RowIndex int    `json:"row_index"`
+	Status   string `json:"status"`
+	Slot     string `json:"slot"`
+}
+
+// ListDevices: Danh sách thiết bị (Lọc theo Group nếu có), kèm nick hiện tại
+func ListDevices(sid, group string) []map[string]interface{} {
+	devices.Lock()
+	b := deviceBookLocked(sid)
+	list := make([]DeviceInfo, 0, len(b.Devices))
+	for _, d := range b.Devices {
+		if group == "" || d.Group == group { list = append(list, *d) }
+	}
+	devices.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen > list[j].LastSeen })
+
+	accounts := make(map[string][]DeviceAccount)
+	if cache, err := LayDuLieu(sid, SHEET_NAMES.DATA_TIKTOK, false); err == nil {
+		STATE.SheetMutex.RLock()
+		for _, d := range list {
+			for _, idx := range cache.AssignedMap[d.DeviceId] {
+				if idx >= len(cache.CleanValues) { continue }
+				cell := cache.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID]
+				slot := "1"
+				if cell != d.DeviceId { slot = strings.TrimPrefix(cell, d.DeviceId+DEVICE_SLOTS.SEPARATOR) }
+				accounts[d.DeviceId] = append(accounts[d.DeviceId], DeviceAccount{
+					RowIndex: RANGES.DATA_START_ROW + idx, Status: SafeString(cache.RawValues[idx][INDEX_DATA_TIKTOK.STATUS]), Slot: slot,
+				})
+			}
+		}
+		STATE.SheetMutex.RUnlock()
+	}
+
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, d := range list {
+		out = append(out, map[string]interface{}{
+			"device_id": d.DeviceId, "first_seen": d.FirstSeen, "last_seen": d.LastSeen, "app_version": d.AppVersion,
+			"group": d.Group, "tags": d.Tags, "accounts": accounts[d.DeviceId],
+		})
+	}
+	return out
+}
+
+// SetDeviceGroup: Gán Group / Tag cho danh sách thiết bị (tags == nil -> Giữ nguyên Tag cũ)
+func SetDeviceGroup(sid string, ids []string, group string, tags []string) int {
+	devices.Lock()
+	defer devices.Unlock()
+
+	b := deviceBookLocked(sid)
+	n := 0
+	for _, id := range ids {
+		if d, ok := b.Devices[baseDevice(CleanString(id))]; ok {
+			d.Group = group
+			if tags != nil { d.Tags = tags }
+			n++
+		}
+	}
+	if n > 0 { devices.Dirty[sid] = true }
+	return n
+}
+
+// DeleteDevices: Xóa thiết bị khỏi sổ (Không đụng tới nick trên Sheet)
+func DeleteDevices(sid string, ids []string) int {
+	devices.Lock()
+	defer devices.Unlock()
+
+	b := deviceBookLocked(sid)
+	n := 0
+	for _, id := range ids {
+		key := baseDevice(CleanString(id))
+		if _, ok := b.Devices[key]; ok { delete(b.Devices, key); n++ }
+	}
+	if n > 0 { devices.Dirty[sid] = true }
+	return n
+}
+
+// SetGroupFilter: Đặt / xóa (rule == nil) bộ lọc nick của 1 Group
+func SetGroupFilter(sid, group string, rule *DeviceGroup) error {
+	if group == "" { return fmt.Errorf("Thiếu group") }
+	devices.Lock()
+	defer devices.Unlock()
+
+	b := deviceBookLocked(sid)
+	if rule == nil { delete(b.Groups, group) } else { b.Groups[group] = rule }
+	devices.Dirty[sid] = true
+	return nil
+}
+
+// deviceGroupFilter: Bộ lọc nick áp cho thiết bị (Theo Group). HasFilter = false nếu không có.
+func deviceGroupFilter(sid, deviceId string) FilterParams {
+	devices.Lock()
+	defer devices.Unlock()
+
+	b := deviceBookLocked(sid)
+	var rule *DeviceGroup
+	if d, ok := b.Devices[baseDevice(deviceId)]; ok && d.Group != "" { rule = b.Groups[d.Group] }
+	if rule == nil { return FilterParams{} }
+
+	body := map[string]interface{}{}
+	if rule.SearchAnd != nil { body["search_and"] = rule.SearchAnd }
+	if rule.SearchOr != nil { body["search_or"] = rule.SearchOr }
+	return parseFilterParams(body)
+}
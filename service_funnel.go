@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// =================================================================================================
+// 🪜 PHỄU ƯU TIÊN DẠNG DỮ LIỆU (PRIORITY FUNNEL)
+// =================================================================================================
+// - Mặc định: DEFAULT_FUNNELS (config.go), giữ đúng thứ tự cũ của login/register/auto/*_reset.
+//   Tenant bật "lease": Thêm bước lấy nick "Đang chờ"/"Chờ đăng ký" trống DeviceId (Nick bị Reaper thu hồi).
+// - Tenant ghi đè trong node Token Firebase (Đọc cùng lúc với Token, không tốn thêm request):
+//   "funnels": {
+//     "login": { "quality": "login", "check_completed": true, "steps": [
+//         { "status": "đăng nhập", "owner": "unassigned" },
+//         { "status": "đang chờ", "owner": "mine", "search_and": { "match_col_6": ["gmail.com"] } }
+//     ]},
+//     "warmup": { ... }   // Action mới -> Gọi /tool/login với "type": "warmup"
+//   }
+
+// FunnelStep: 1 bước của phễu
+type FunnelStep struct {
+	Status  string       // Trạng thái (Dạng đọc: lowercase)
+	Owner   string       // "mine" | "unassigned" | "any" (Mặc định "mine")
+	PrioID  int          // Mã bước (Chỉ để đối chiếu khi đọc cấu hình)
+	Reset   bool         // Lấy nick ở bước này = Reset (Tăng số lần chạy, dọn cả nick Hoàn thành cũ)
+	Filters FilterParams // Bộ lọc riêng của bước (search_and / search_or)
+}
+
+// Funnel: Phễu của 1 action
+type Funnel struct {
+	Quality        string // Kiểu kiểm tra chất lượng nick (KiemTraChatLuongClean): "login" | "register" | "auto" | "view_only"
+	CheckCompleted bool   // Hết nick -> Báo "Các tài khoản đã hoàn thành" nếu Device có nick Hoàn thành
+	Activity       string // "post" | "follow" -> Bỏ qua nick đã hết hạn mức trong ngày (Body "activity" ghi đè)
+	Steps          []FunnelStep
+}
+
+// matchOwner: Kiểm tra quyền sở hữu theo Owner của bước.
+// devKey = DeviceId kèm Slot (deviceKey). Nick đang giữ phải đúng Slot, còn lại chỉ cần đúng thiết bị.
+func (s FunnelStep) matchOwner(rowDevice, devKey string) bool {
+	switch s.Owner {
+	case "mine":
+		if isLeasedStatus(s.Status) { return rowDevice == devKey }
+		return sameDevice(rowDevice, devKey)
+	case "unassigned":
+		return rowDevice == ""
+	case "any": // Kể cả nick đang thuộc Device khác
+		return true
+	}
+	return false
+}
+
+// resolveFunnel: Tenant (Token Firebase) -> Mặc định. Không có -> ok = false.
+func resolveFunnel(tokenData *TokenData, action string) (Funnel, bool) {
+	if tokenData != nil {
+		if all, ok := tokenData.Data["funnels"].(map[string]interface{}); ok {
+			if raw, ok := all[action]; ok {
+				f, err := parseFunnel(raw, action)
+				if err == nil { return f, true }
+				log.Printf("⚠️ [FUNNEL] %s / %s: %v -> Dùng phễu mặc định", tokenData.SpreadsheetID, action, err)
+			}
+		}
+	}
+	f, ok := DEFAULT_FUNNELS[action]
+	if ok && tokenData != nil {
+		if _, on := leaseTTL(tokenData.SpreadsheetID); on { f = withReclaimedSteps(f) }
+	}
+	return f, ok
+}
+
+// withReclaimedSteps: Sau bước lấy nick kho chung (Đăng nhập / Đăng ký) -> Lấy tiếp nick bị thu hồi Lease cùng mức ưu tiên
+func withReclaimedSteps(f Funnel) Funnel {
+	steps := make([]FunnelStep, 0, len(f.Steps)+2)
+	for _, s := range f.Steps {
+		steps = append(steps, s)
+		if s.Owner != "unassigned" { continue }
+		switch s.Status {
+		case STATUS_READ.LOGIN:
+			steps = append(steps, FunnelStep{Status: STATUS_READ.WAITING, Owner: "unassigned", PrioID: s.PrioID})
+		case STATUS_READ.REGISTER:
+			steps = append(steps, FunnelStep{Status: STATUS_READ.WAIT_REG, Owner: "unassigned", PrioID: s.PrioID})
+		}
+	}
+	f.Steps = steps
+	return f
+}
+
+// parseFunnel: Đọc phễu từ JSON Firebase
+func parseFunnel(raw interface{}, action string) (Funnel, error) {
+	m, ok := raw.(map[string]interface{})
+	if !ok { return Funnel{}, fmt.Errorf("Phễu không đúng định dạng") }
+
+	f := Funnel{Quality: CleanString(m["quality"]), CheckCompleted: fmt.Sprintf("%v", m["check_completed"]) == "true", Activity: CleanString(m["activity"])}
+	if f.Quality == "" { f.Quality = action }
+
+	list, _ := m["steps"].([]interface{})
+	for i, item := range list {
+		sm, ok := item.(map[string]interface{})
+		if !ok { return Funnel{}, fmt.Errorf("Bước %d không đúng định dạng", i+1) }
+		step := FunnelStep{
+			Status:  CleanString(sm["status"]),
+			Owner:   CleanString(sm["owner"]),
+			PrioID:  i + 1,
+			Reset:   fmt.Sprintf("%v", sm["reset"]) == "true",
+			Filters: parseFilterParams(sm),
+		}
+		if v, ok := toFloat(sm["prio"]); ok { step.PrioID = int(v) }
+		if step.Owner == "" { step.Owner = "mine" }
+		if step.Status == "" { return Funnel{}, fmt.Errorf("Bước %d thiếu status", i+1) }
+		if step.Owner != "mine" && step.Owner != "unassigned" && step.Owner != "any" {
+			return Funnel{}, fmt.Errorf("Bước %d: owner không hợp lệ (%s)", i+1, step.Owner)
+		}
+		f.Steps = append(f.Steps, step)
+	}
+	if len(f.Steps) == 0 { return Funnel{}, fmt.Errorf("Phễu không có bước nào") }
+	return f, nil
+}
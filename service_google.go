@@ -2,24 +2,107 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
 var sheetsService *sheets.Service
+var driveService *drive.Service // Chỉ dùng hỏi modifiedTime (VersionProber). nil -> Watcher đọc đầy đủ
 
-func InitGoogleService(credJSON []byte) {
+// InitGoogleService: Không Fatal nữa, trả lỗi để InitSheetStore lùi về Memory Store
+func InitGoogleService(credJSON []byte) error {
+	if len(credJSON) == 0 {
+		return fmt.Errorf("Dữ liệu Credential bị trống")
+	}
 	ctx := context.Background()
 	srv, err := sheets.NewService(ctx, option.WithCredentialsJSON(credJSON))
 	if err != nil {
-		log.Fatalf("❌ [GOOGLE INIT] Error: %v", err)
+		log.Printf("❌ [GOOGLE INIT] Error: %v", err)
+		return err
 	}
 	sheetsService = srv
+	if d, err := drive.NewService(ctx, option.WithCredentialsJSON(credJSON), option.WithScopes(drive.DriveMetadataReadonlyScope)); err == nil {
+		driveService = d
+	} else {
+		log.Printf("⚠️ [GOOGLE INIT] Drive: %v -> Watcher đọc cả Sheet mỗi lượt", err)
+	}
 	fmt.Println("✅ Google Service initialized (Partitioned Cache Ready).")
+	return nil
+}
+
+// --- GOOGLE SHEET STORE (Triển khai SheetStore bằng Google Sheets API) ---
+
+type GoogleSheetStore struct {
+	srv   *sheets.Service
+	drive *drive.Service
+}
+
+// SheetVersion: modifiedTime của file trên Drive (Cả Spreadsheet, mọi Sheet con dùng chung)
+func (g *GoogleSheetStore) SheetVersion(sid, sheetName string) (string, error) {
+	if g.drive == nil { return "", nil }
+	f, err := g.drive.Files.Get(sid).Fields("modifiedTime").SupportsAllDrives(true).Do()
+	if err != nil { return "", err }
+	return f.ModifiedTime, nil
+}
+
+func (g *GoogleSheetStore) LoadRows(sid, sheetName string) ([][]interface{}, error) {
+	readRange := fmt.Sprintf("'%s'!A%d:%s%d", sheetName, RANGES.DATA_START_ROW, RANGES.LIMIT_COL_FULL, RANGES.DATA_MAX_ROW)
+	resp, err := g.srv.Spreadsheets.Values.Get(sid, readRange).Do()
+	if err != nil {
+		return nil, err
+	}
+	if resp.Values == nil {
+		return [][]interface{}{}, nil
+	}
+	return resp.Values, nil
+}
+
+func (g *GoogleSheetStore) WriteBlocks(sid string, blocks []CellBlock) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	batchData := make([]*sheets.ValueRange, 0, len(blocks))
+	for _, b := range blocks {
+		batchData = append(batchData, &sheets.ValueRange{
+			Range:  fmt.Sprintf("'%s'!%s%d", b.Sheet, ColumnLetter(b.Col), RANGES.DATA_START_ROW+b.Row),
+			Values: b.Values,
+		})
+	}
+	_, err := g.srv.Spreadsheets.Values.BatchUpdate(sid, &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "RAW",
+		Data:             batchData,
+	}).Do()
+	return err
+}
+
+func (g *GoogleSheetStore) AppendRows(sid, sheetName string, rows [][]interface{}) error {
+	_, err := g.srv.Spreadsheets.Values.Append(sid, fmt.Sprintf("'%s'!A1", sheetName), &sheets.ValueRange{
+		Values: rows,
+	}).ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Do()
+	return err
+}
+
+// ColumnLetter: Đổi index cột (0) -> Tên cột (A). Ví dụ: 60 -> BI
+func ColumnLetter(idx int) string {
+	name := ""
+	for n := idx + 1; n > 0; n = (n - 1) / 26 {
+		name = string(rune('A'+(n-1)%26)) + name
+	}
+	return name
 }
 
 // 🔥 Hàm nạp dữ liệu thông minh (Smart Load)
@@ -29,29 +112,109 @@ func LayDuLieu(spreadsheetId, sheetName string, forceLoad bool) (*SheetCacheData
 	cached, exists := STATE.SheetCache[cacheKey]
 	STATE.SheetMutex.RUnlock()
 
-	// Nếu có Cache và chưa hết hạn -> Trả về ngay
 	if exists && !forceLoad {
-		if time.Now().UnixMilli()-cached.Timestamp < cached.TTL {
-			// Update access time (dùng atomic hoặc lock nhẹ nếu cần, ở đây bỏ qua cho đơn giản)
+		age := time.Now().UnixMilli() - cached.Timestamp
+		// Nếu có Cache và chưa hết hạn -> Trả về ngay
+		if age < cached.TTL {
+			atomic.StoreInt64(&cached.LastAccessed, time.Now().UnixMilli()) // Phục vụ LRU
+			return cached, nil
+		}
+		// Hết hạn nhưng chưa quá cũ -> Trả bản cũ, nạp lại ở nền (Stale-While-Revalidate)
+		if age < cached.TTL+CACHE.SHEET_STALE_MS {
+			go func() {
+				if _, err := loadSheetOnce(spreadsheetId, sheetName, false); err != nil {
+					log.Printf("⚠️ [CACHE] Nạp lại nền %s thất bại: %v", cacheKey, err)
+				}
+			}()
+			atomic.StoreInt64(&cached.LastAccessed, time.Now().UnixMilli())
 			return cached, nil
 		}
 	}
 
-	// Nếu không có hoặc ép load lại -> Gọi Google API
-	readRange := fmt.Sprintf("'%s'!A%d:%s%d", sheetName, RANGES.DATA_START_ROW, RANGES.LIMIT_COL_FULL, RANGES.DATA_MAX_ROW)
-	resp, err := sheetsService.Spreadsheets.Values.Get(spreadsheetId, readRange).Do()
+	// Không có / quá cũ / ép load lại -> Chờ lượt nạp chung (Chỉ 1 lệnh đọc Store mỗi Key)
+	return loadSheetOnce(spreadsheetId, sheetName, forceLoad)
+}
+
+// sheetLoads: Các lượt nạp đang chạy (Singleflight). Key = cacheKey.
+var sheetLoads = struct {
+	sync.Mutex
+	Calls map[string]*sheetLoadCall
+}{
+	Calls: make(map[string]*sheetLoadCall),
+}
+
+type sheetLoadCall struct {
+	done chan struct{}
+	data *SheetCacheData
+	err  error
+}
+
+// loadSheetOnce: Gom mọi Request cùng Key vào 1 lượt đọc Store. Người đến sau chờ kết quả chung.
+func loadSheetOnce(spreadsheetId, sheetName string, forceLoad bool) (*SheetCacheData, error) {
+	cacheKey := spreadsheetId + KEY_SEPARATOR + sheetName
+
+	sheetLoads.Lock()
+	if call, ok := sheetLoads.Calls[cacheKey]; ok {
+		sheetLoads.Unlock()
+		<-call.done
+		return call.data, call.err
+	}
+	call := &sheetLoadCall{done: make(chan struct{})}
+	sheetLoads.Calls[cacheKey] = call
+	sheetLoads.Unlock()
+
+	call.data, call.err = loadSheet(spreadsheetId, sheetName, forceLoad)
+
+	sheetLoads.Lock()
+	delete(sheetLoads.Calls, cacheKey)
+	sheetLoads.Unlock()
+	close(call.done)
+	return call.data, call.err
+}
+
+// loadSheet: Đọc Store và cập nhật Cache (Chỉ gọi qua loadSheetOnce)
+func loadSheet(spreadsheetId, sheetName string, forceLoad bool) (*SheetCacheData, error) {
+	cacheKey := spreadsheetId + KEY_SEPARATOR + sheetName
+
+	// Người chạy trước vừa nạp xong -> Không đọc lại
+	STATE.SheetMutex.RLock()
+	cached, exists := STATE.SheetCache[cacheKey]
+	var baseGen int64
+	if exists { baseGen = cached.BaseGen }
+	STATE.SheetMutex.RUnlock()
+	if exists && !forceLoad && time.Now().UnixMilli()-cached.Timestamp < cached.TTL {
+		return cached, nil
+	}
+
+	// Gọi Store (Google / RAM)
+	rawRows, err := sheetStore.LoadRows(spreadsheetId, sheetName)
 	if err != nil {
 		return nil, err
 	}
 
-	rawRows := resp.Values
-	if rawRows == nil {
-		rawRows = [][]interface{}{}
+	// Đã có Cache DataTiktok -> Hợp nhất 3 chiều (Giữ phân bổ trong RAM & thay đổi đang chờ ghi) thay vì đè mù
+	if exists && sheetName == SHEET_NAMES.DATA_TIKTOK {
+		reconcileSheet(spreadsheetId, sheetName, cached, rawRows, baseGen)
+		atomic.StoreInt64(&cached.LastAccessed, time.Now().UnixMilli())
+		return cached, nil
 	}
 
+	newData := buildSheetCache(sheetName, rawRows)
+
+	STATE.SheetMutex.Lock()
+	STATE.SheetCache[cacheKey] = newData
+	evictSheetCacheLocked(cacheKey) // Giữ Cache trong giới hạn SHEET_MAX_KEYS / SHEET_MAX_BYTES
+	STATE.SheetMutex.Unlock()
+	if sheetName == SHEET_NAMES.DATA_TIKTOK { sealSheet(spreadsheetId, newData) } // Ô nhạy cảm còn dạng rõ -> Mã hóa
+
+	return newData, nil
+}
+
+// buildSheetCache: Chuẩn hóa & phân vùng dữ liệu thô thành SheetCacheData
+func buildSheetCache(sheetName string, rawRows [][]interface{}) *SheetCacheData {
 	// Khởi tạo cấu trúc phân vùng
 	cleanValues := make([][]string, len(rawRows))
-	assignedMap := make(map[string]int)
+	assignedMap := make(map[string][]int)
 	unassignedList := make([]int, 0)
 	statusMap := make(map[string][]int)
 
@@ -77,7 +240,7 @@ func LayDuLieu(spreadsheetId, sheetName string, forceLoad bool) (*SheetCacheData
 
 			// 1. Phân loại theo DeviceID (Sở hữu riêng vs Kho chung)
 			if deviceID != "" {
-				assignedMap[deviceID] = i // Map nhanh: DeviceID -> RowIndex
+				assignedMap[baseDevice(deviceID)] = append(assignedMap[baseDevice(deviceID)], i) // DeviceID -> Các RowIndex (Mọi Slot)
 			} else {
 				unassignedList = append(unassignedList, i) // List nick trống
 			}
@@ -90,7 +253,7 @@ func LayDuLieu(spreadsheetId, sheetName string, forceLoad bool) (*SheetCacheData
 	}
 
 	// Đóng gói vào Cache
-	newData := &SheetCacheData{
+	data := &SheetCacheData{
 		RawValues:      rawRows,
 		CleanValues:    cleanValues,
 		AssignedMap:    assignedMap,
@@ -100,124 +263,403 @@ func LayDuLieu(spreadsheetId, sheetName string, forceLoad bool) (*SheetCacheData
 		TTL:            CACHE.SHEET_VALID_MS,
 		LastAccessed:   time.Now().UnixMilli(),
 	}
+	// Bản chụp trạng thái trên Store -> Dùng để phát hiện & hợp nhất chỉnh sửa tay (Chỉ DataTiktok)
+	if isDataTiktok { data.BaseValues = copyRows(rawRows) }
+	data.SizeBytes = estimateCacheBytes(data)
+	return data
+}
 
-	STATE.SheetMutex.Lock()
-	STATE.SheetCache[cacheKey] = newData
-	STATE.SheetMutex.Unlock()
+// estimateCacheBytes: Ước lượng RAM của 1 Cache (Raw + Clean + Base). Không cần chính xác tuyệt đối.
+func estimateCacheBytes(c *SheetCacheData) int64 {
+	var size int64
+	for _, row := range c.RawValues {
+		for _, v := range row {
+			if s, ok := v.(string); ok { size += int64(len(s)) }
+			size += 16 // interface{} header
+		}
+	}
+	for _, row := range c.CleanValues {
+		for _, v := range row { size += int64(len(v)) + 16 } // string header
+	}
+	if c.BaseValues != nil { size += int64(len(c.BaseValues)) * 24 + size/3 } // Base dùng chung giá trị, chỉ tốn slice
+	return size
+}
 
-	return newData, nil
+// evictSheetCacheLocked: Loại Cache ít dùng nhất (LRU) khi vượt giới hạn.
+// KHÔNG BAO GIỜ loại Sheet còn dữ liệu chờ ghi (Sẽ mất thay đổi trong RAM). Yêu cầu đang giữ SheetMutex.
+func evictSheetCacheLocked(keepKey string) {
+	for {
+		var total int64
+		for _, c := range STATE.SheetCache { total += c.SizeBytes }
+		if len(STATE.SheetCache) <= CACHE.SHEET_MAX_KEYS && total <= CACHE.SHEET_MAX_BYTES { return }
+
+		victim := ""
+		oldest := int64(0)
+		STATE.QueueMutex.Lock()
+		for k, c := range STATE.SheetCache {
+			if k == keepKey || hasPendingWritesLocked(k) { continue }
+			if last := atomic.LoadInt64(&c.LastAccessed); victim == "" || last < oldest {
+				victim, oldest = k, last
+			}
+		}
+		STATE.QueueMutex.Unlock()
+
+		if victim == "" { return } // Tất cả đều đang chờ ghi -> Chấp nhận vượt tạm thời
+		log.Printf("🧹 [CACHE] Evict %s (%d KB)", victim, STATE.SheetCache[victim].SizeBytes/1024)
+		delete(STATE.SheetCache, victim)
+	}
+}
+
+// hasPendingWritesLocked: Cache Key này còn ô chờ ghi / đang Flush không. Yêu cầu đang giữ QueueMutex.
+func hasPendingWritesLocked(cacheKey string) bool {
+	parts := strings.SplitN(cacheKey, KEY_SEPARATOR, 2)
+	if len(parts) != 2 { return false }
+	q, ok := STATE.WriteQueue[parts[0]]
+	if !ok { return false }
+	return q.IsFlushing || len(q.Updates[parts[1]]) > 0
+}
+
+// copyRows: Sao chép nông từng dòng (Giá trị ô dùng chung, slice dòng tách riêng)
+func copyRows(rows [][]interface{}) [][]interface{} {
+	out := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		out[i] = make([]interface{}, len(row))
+		copy(out[i], row)
+	}
+	return out
 }
 
 // --- QUEUE SYSTEM (Hệ thống ghi đĩa) ---
 
-func QueueUpdate(sid, sheetName string, rowIndex int, rowData []interface{}) {
+// QueueUpdate: Ghi đè CẢ DÒNG (Mọi cột đều coi là bẩn). Ưu tiên dùng QueueUpdateCells.
+func QueueUpdate(sid, sheetName string, rowIndex int, rowData []interface{}) journalTicket {
+	cells := make(RowCells, len(rowData))
+	for col, val := range rowData { cells[col] = val }
+	return QueueUpdateCells(sid, sheetName, rowIndex, cells)
+}
+
+// QueueUpdateCells: Chỉ ghi các ô đã thay đổi -> Không đè lên chỉnh sửa tay của Operator ở cột khác.
+// Trả về biên nhận WAL: Gọi Wait() sau khi nhả SheetMutex, trước khi trả lời Tool.
+func QueueUpdateCells(sid, sheetName string, rowIndex int, cells RowCells) journalTicket {
+	if len(cells) == 0 { return journalTicket{} }
+	return QueueUpdateRows(sid, sheetName, map[int]RowCells{rowIndex: cells})
+}
+
+// QueueUpdateRows: Nhiều dòng trong 1 lần ghi WAL (Job nền: Reset ngày, mã hóa lại...)
+func QueueUpdateRows(sid, sheetName string, rows map[int]RowCells) journalTicket {
+	var entries []JournalEntry
+	for idx, cells := range rows {
+		if len(cells) > 0 { entries = append(entries, JournalEntry{Sid: sid, Op: "update", Sheet: sheetName, Row: idx, Cells: cells}) }
+	}
+	if len(entries) == 0 { return journalTicket{} }
+
 	STATE.QueueMutex.Lock()
 	defer STATE.QueueMutex.Unlock()
 
-	if _, ok := STATE.WriteQueue[sid]; !ok {
-		STATE.WriteQueue[sid] = &WriteQueueData{
-			Updates: make(map[string]map[int][]interface{}),
-			Appends: make(map[string][][]interface{}),
-		}
-	}
-	q := STATE.WriteQueue[sid]
+	q := getQueueLocked(sid)
+	for _, e := range entries { mergeCellsLocked(q, sheetName, e.Row, e.Cells, true) }
+
+	// Ghi WAL trước khi Handler trả lời (Chống mất dữ liệu khi sập)
+	t := journalWrite(entries...)
+	scheduleFlushLocked(sid, q)
+	return t
+}
 
+// mergeCellsLocked: Gộp ô bẩn vào Queue. overwrite=false -> Không đè lên giá trị mới hơn đang chờ.
+func mergeCellsLocked(q *WriteQueueData, sheetName string, rowIndex int, cells RowCells, overwrite bool) {
 	if _, ok := q.Updates[sheetName]; !ok {
-		q.Updates[sheetName] = make(map[int][]interface{})
+		q.Updates[sheetName] = make(map[int]RowCells)
 	}
-	q.Updates[sheetName][rowIndex] = rowData
-
-	if !q.Timer {
-		q.Timer = true
-		go func(id string) {
-			time.Sleep(time.Duration(QUEUE.FLUSH_INTERVAL_MS) * time.Millisecond)
-			FlushQueue(id, false)
-		}(sid)
+	dirty, ok := q.Updates[sheetName][rowIndex]
+	if !ok {
+		dirty = make(RowCells, len(cells))
+		q.Updates[sheetName][rowIndex] = dirty
+	}
+	for col, val := range cells {
+		if _, newer := dirty[col]; newer && !overwrite { continue }
+		dirty[col] = val
 	}
 }
 
-func QueueAppend(sid, sheetName string, rowsData [][]interface{}) {
+// QueueAppend: Thêm dòng (Mỗi dòng mang 1 Seq để Replay không ghi trùng). Trả về biên nhận WAL.
+func QueueAppend(sid, sheetName string, rowsData [][]interface{}) journalTicket {
+	if len(rowsData) == 0 { return journalTicket{} }
 	STATE.QueueMutex.Lock()
 	defer STATE.QueueMutex.Unlock()
 
+	q := getQueueLocked(sid)
+	seqs := make([]int64, len(rowsData))
+	for i := range seqs { q.LastSeq++; seqs[i] = q.LastSeq }
+	q.Appends[sheetName] = append(q.Appends[sheetName], rowsData...)
+	q.AppendSeqs[sheetName] = append(q.AppendSeqs[sheetName], seqs...)
+
+	t := journalWrite(JournalEntry{Sid: sid, Op: "append", Sheet: sheetName, Rows: rowsData, Seqs: seqs})
+	scheduleFlushLocked(sid, q)
+	return t
+}
+
+// getQueueLocked: Lấy (hoặc tạo) Queue của 1 Sheet. Yêu cầu đang giữ STATE.QueueMutex.
+func getQueueLocked(sid string) *WriteQueueData {
 	if _, ok := STATE.WriteQueue[sid]; !ok {
 		STATE.WriteQueue[sid] = &WriteQueueData{
-			Updates: make(map[string]map[int][]interface{}),
-			Appends: make(map[string][][]interface{}),
+			Updates:    make(map[string]map[int]RowCells),
+			Appends:    make(map[string][][]interface{}),
+			AppendSeqs: make(map[string][]int64),
+			Attempts:   make(map[string]int),
+			Applied:    make(map[string]int64),
 		}
 	}
-	q := STATE.WriteQueue[sid]
-
-	q.Appends[sheetName] = append(q.Appends[sheetName], rowsData...)
+	return STATE.WriteQueue[sid]
+}
 
+// scheduleFlushLocked: Hẹn giờ xả Queue (nếu chưa hẹn). Yêu cầu đang giữ STATE.QueueMutex.
+func scheduleFlushLocked(sid string, q *WriteQueueData) {
 	if !q.Timer {
 		q.Timer = true
+		delay := QUEUE.FLUSH_INTERVAL_MS
+		if wait := q.RetryAt - time.Now().UnixMilli(); wait > delay { delay = wait } // Tôn trọng Backoff
 		go func(id string) {
-			time.Sleep(time.Duration(QUEUE.FLUSH_INTERVAL_MS) * time.Millisecond)
+			time.Sleep(time.Duration(delay) * time.Millisecond)
 			FlushQueue(id, false)
 		}(sid)
 	}
 }
 
+// markAppendApplied: Store đã nhận các dòng Append có Seq <= seq -> Ghi mốc vào WAL ngay (Sập trước khi nén cũng không ghi trùng)
+func markAppendApplied(sid string, q *WriteQueueData, sheet string, seq int64) {
+	STATE.QueueMutex.Lock()
+	if seq > q.Applied[sheet] { q.Applied[sheet] = seq }
+	t := journalWrite(JournalEntry{Sid: sid, Op: "applied", Sheet: sheet, Seq: seq})
+	STATE.QueueMutex.Unlock()
+	t.Wait()
+}
+
 func FlushQueue(sid string, isShutdown bool) {
 	STATE.QueueMutex.Lock()
 	q, ok := STATE.WriteQueue[sid]
 	if !ok || q.IsFlushing {
+		if ok { q.Timer = false } // Timer này đã chạy xong -> Cho phép hẹn lại sau khi Flush hiện tại kết thúc
 		STATE.QueueMutex.Unlock()
 		return
 	}
-	q.IsFlushing = true
 	q.Timer = false // Reset timer flag
 
-	// Snapshot dữ liệu để nhả Lock sớm
+	// Đang trong thời gian Backoff (sau lỗi 429/5xx) -> Hẹn lại, trừ khi Shutdown
+	if !isShutdown && time.Now().UnixMilli() < q.RetryAt {
+		scheduleFlushLocked(sid, q)
+		STATE.QueueMutex.Unlock()
+		return
+	}
+	q.IsFlushing = true
+
+	// Snapshot dữ liệu để nhả Lock sớm (Giữ lại trong q.Flush* để WAL nén giữa chừng không làm mất)
 	updates := q.Updates
 	appends := q.Appends
+	appendSeqs := q.AppendSeqs
+	q.FlushUpdates, q.FlushAppends, q.FlushSeqs = updates, appends, appendSeqs
 	// Reset Queue
-	q.Updates = make(map[string]map[int][]interface{})
+	q.Updates = make(map[string]map[int]RowCells)
 	q.Appends = make(map[string][][]interface{})
+	q.AppendSeqs = make(map[string][]int64)
 	STATE.QueueMutex.Unlock()
 
 	// Thực thi ghi (Không giữ Lock)
+	// Phần ghi lỗi được giữ lại để phân loại: Thử lại (Backoff) hoặc chuyển Dead-letter
+	type failedUpdate struct { rows map[int]RowCells; err error }
+	type failedAppend struct { rows [][]interface{}; seqs []int64; err error }
+	failedUpdates := make(map[string]failedUpdate)
+	failedAppends := make(map[string]failedAppend)
+
 	for sheet, rowMap := range updates {
-		var batchData []*sheets.ValueRange
-		for idx, row := range rowMap {
-			rng := fmt.Sprintf("'%s'!A%d", sheet, RANGES.DATA_START_ROW+idx)
-			batchData = append(batchData, &sheets.ValueRange{
-				Range:  rng,
-				Values: [][]interface{}{row},
-			})
-		}
-		if len(batchData) > 0 {
-			_, err := sheetsService.Spreadsheets.Values.BatchUpdate(sid, &sheets.BatchUpdateValuesRequest{
-				ValueInputOption: "RAW",
-				Data:             batchData,
-			}).Do()
+		// Gộp các ô bẩn liền kề thành Range tối thiểu, rồi chia Chunk theo số dòng & dung lượng
+		for _, chunk := range chunkBlocks(coalesceCells(sheet, rowMap)) {
+			err := sheetStore.WriteBlocks(sid, chunk)
+			if err == nil { applyBlocksToBase(sid, chunk) } // Store đã nhận -> Cập nhật bản chụp Base
 			if err != nil {
 				log.Printf("❌ [FLUSH UPDATE] %s: %v", sheet, err)
+				f, ok := failedUpdates[sheet]
+				if !ok { f = failedUpdate{rows: make(map[int]RowCells)} }
+				for _, b := range chunk {
+					for r, vals := range b.Values {
+						if _, ok := f.rows[b.Row+r]; !ok { f.rows[b.Row+r] = make(RowCells) }
+						for c, v := range vals { f.rows[b.Row+r][b.Col+c] = v }
+					}
+				}
+				f.err = err
+				failedUpdates[sheet] = f
 			}
 		}
 	}
 
 	for sheet, rows := range appends {
-		if len(rows) > 0 {
-			_, err := sheetsService.Spreadsheets.Values.Append(sid, fmt.Sprintf("'%s'!A1", sheet), &sheets.ValueRange{
-				Values: rows,
-			}).ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Do()
-			if err != nil {
+		seqs := appendSeqs[sheet]
+		start := 0
+		for _, chunk := range chunkRows(rows) {
+			if err := sheetStore.AppendRows(sid, sheet, chunk); err != nil {
 				log.Printf("❌ [FLUSH APPEND] %s: %v", sheet, err)
+				// Dừng tại Chunk lỗi để giữ đúng thứ tự dòng khi thử lại
+				failedAppends[sheet] = failedAppend{rows[start:], seqs[start:], err}
+				break
 			}
+			start += len(chunk)
+			markAppendApplied(sid, q, sheet, seqs[start-1])
 		}
 	}
 
 	STATE.QueueMutex.Lock()
 	q.IsFlushing = false
-	// Nếu trong lúc ghi có dữ liệu mới -> Kích hoạt timer tiếp
-	if (len(q.Updates) > 0 || len(q.Appends) > 0) && !q.Timer && !isShutdown {
-		q.Timer = true
-		go func(id string) {
-			time.Sleep(time.Duration(QUEUE.FLUSH_INTERVAL_MS) * time.Millisecond)
-			FlushQueue(id, false)
-		}(sid)
+	q.FlushUpdates, q.FlushAppends, q.FlushSeqs = nil, nil, nil
+	maxAttempts := 0
+
+	// giveUp: Tăng số lần thử, trả về true nếu phải bỏ cuộc (Lỗi vĩnh viễn hoặc hết lượt)
+	giveUp := func(key string, err error) bool {
+		q.Attempts[key]++
+		if q.Attempts[key] > maxAttempts { maxAttempts = q.Attempts[key] }
+		return !isRetryableStoreError(err) || q.Attempts[key] >= QUEUE.MAX_RETRY
+	}
+
+	for sheet := range updates {
+		key := "update:" + sheet
+		f, failed := failedUpdates[sheet]
+		if !failed { delete(q.Attempts, key); continue }
+		if giveUp(key, f.err) {
+			addDeadLetter(sid, DeadLetterEntry{Sheet: sheet, Op: "update", Updates: f.rows, Error: f.err.Error(), Attempts: q.Attempts[key]})
+			delete(q.Attempts, key)
+			continue
+		}
+		// Trả về Queue (Không đè lên ô mới hơn được Queue trong lúc ghi)
+		for idx, cells := range f.rows { mergeCellsLocked(q, sheet, idx, cells, false) }
+	}
+	for sheet := range appends {
+		key := "append:" + sheet
+		f, failed := failedAppends[sheet]
+		if !failed { delete(q.Attempts, key); continue }
+		if giveUp(key, f.err) {
+			addDeadLetter(sid, DeadLetterEntry{Sheet: sheet, Op: "append", Rows: f.rows, Error: f.err.Error(), Attempts: q.Attempts[key]})
+			delete(q.Attempts, key)
+			continue
+		}
+		q.Appends[sheet] = append(f.rows, q.Appends[sheet]...)
+		q.AppendSeqs[sheet] = append(f.seqs, q.AppendSeqs[sheet]...)
+	}
+
+	// Exponential Backoff: 2s, 4s, 8s... (Tối đa QUEUE.RETRY_MAX_MS)
+	q.RetryAt = 0
+	if len(q.Attempts) > 0 && maxAttempts > 0 {
+		delay := QUEUE.FLUSH_INTERVAL_MS << uint(maxAttempts)
+		if delay > QUEUE.RETRY_MAX_MS || delay <= 0 { delay = QUEUE.RETRY_MAX_MS }
+		q.RetryAt = time.Now().UnixMilli() + delay
+	}
+
+	// Google đã xác nhận -> Cắt bớt WAL, chỉ giữ phần còn chờ
+	journalCompact(sid, q)
+
+	// Nếu trong lúc ghi có dữ liệu mới (hoặc cần thử lại) -> Kích hoạt timer tiếp
+	if (len(q.Updates) > 0 || len(q.Appends) > 0) && !isShutdown {
+		scheduleFlushLocked(sid, q)
 	}
 	STATE.QueueMutex.Unlock()
 }
+
+// isRetryableStoreError: Phân loại lỗi ghi.
+// - Thử lại: 429 (Quota), 5xx (Google lỗi), lỗi mạng / Timeout, SQL mất kết nối hoặc đang bận
+// - Vĩnh viễn: Range sai, Sheet không tồn tại, không có quyền (4xx khác) & mọi lỗi không nhận dạng được
+func isRetryableStoreError(err error) bool {
+	var perm *PermanentStoreError
+	if errors.As(err, &perm) { return false }
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) { return gErr.Code == 429 || gErr.Code >= 500 }
+	var netErr net.Error
+	if errors.As(err, &netErr) { return true }
+	for _, e := range []error{context.DeadlineExceeded, io.ErrUnexpectedEOF, syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.EPIPE} {
+		if errors.Is(err, e) { return true }
+	}
+	return isRetryableSQLError(err)
+}
+
+// --- CHIA NHỎ BATCH (Theo QUEUE.BATCH_LIMIT_BASE & QUEUE.BATCH_MAX_BYTES) ---
+
+// coalesceCells: Gộp các ô bẩn thành Range tối thiểu.
+// - Ngang: Các cột liền kề trong 1 dòng -> 1 đoạn (Segment)
+// - Dọc: Các đoạn cùng cột bắt đầu & độ rộng ở dòng liền kề -> 1 Block nhiều dòng
+// Mỗi Block không vượt quá QUEUE.BATCH_LIMIT_BASE dòng.
+func coalesceCells(sheet string, rowMap map[int]RowCells) []CellBlock {
+	var segs []CellBlock
+	for idx, cells := range rowMap {
+		cols := make([]int, 0, len(cells))
+		for c := range cells { if c >= 0 { cols = append(cols, c) } }
+		sort.Ints(cols)
+		for i := 0; i < len(cols); {
+			j := i
+			for j+1 < len(cols) && cols[j+1] == cols[j]+1 { j++ }
+			vals := make([]interface{}, 0, j-i+1)
+			for k := i; k <= j; k++ { vals = append(vals, cells[cols[k]]) }
+			segs = append(segs, CellBlock{Sheet: sheet, Row: idx, Col: cols[i], Values: [][]interface{}{vals}})
+			i = j + 1
+		}
+	}
+
+	sort.Slice(segs, func(a, b int) bool {
+		if segs[a].Col != segs[b].Col { return segs[a].Col < segs[b].Col }
+		if len(segs[a].Values[0]) != len(segs[b].Values[0]) { return len(segs[a].Values[0]) < len(segs[b].Values[0]) }
+		return segs[a].Row < segs[b].Row
+	})
+
+	var blocks []CellBlock
+	for _, seg := range segs {
+		n := len(blocks)
+		if n > 0 {
+			last := &blocks[n-1]
+			if last.Col == seg.Col && len(last.Values[0]) == len(seg.Values[0]) &&
+				last.Row+len(last.Values) == seg.Row && len(last.Values) < QUEUE.BATCH_LIMIT_BASE {
+				last.Values = append(last.Values, seg.Values[0])
+				continue
+			}
+		}
+		blocks = append(blocks, seg)
+	}
+	return blocks
+}
+
+// chunkBlocks: Chia danh sách Block thành nhiều lần gọi API (Mỗi lần <= BATCH_LIMIT_BASE dòng / BATCH_MAX_BYTES)
+func chunkBlocks(blocks []CellBlock) [][]CellBlock {
+	var chunks [][]CellBlock
+	var cur []CellBlock
+	rows, size := 0, 0
+	for _, b := range blocks {
+		bSize := 0
+		for _, row := range b.Values { bSize += estimateRowBytes(row) }
+		if len(cur) > 0 && (rows+len(b.Values) > QUEUE.BATCH_LIMIT_BASE || size+bSize > QUEUE.BATCH_MAX_BYTES) {
+			chunks = append(chunks, cur)
+			cur, rows, size = nil, 0, 0
+		}
+		cur = append(cur, b)
+		rows += len(b.Values)
+		size += bSize
+	}
+	if len(cur) > 0 { chunks = append(chunks, cur) }
+	return chunks
+}
+
+// chunkRows: Chia danh sách dòng Append (Giữ nguyên thứ tự)
+func chunkRows(rows [][]interface{}) [][][]interface{} {
+	var chunks [][][]interface{}
+	start, size := 0, 0
+	for i, row := range rows {
+		rSize := estimateRowBytes(row)
+		if i > start && (i-start >= QUEUE.BATCH_LIMIT_BASE || size+rSize > QUEUE.BATCH_MAX_BYTES) {
+			chunks = append(chunks, rows[start:i])
+			start, size = i, 0
+		}
+		size += rSize
+	}
+	if start < len(rows) { chunks = append(chunks, rows[start:]) }
+	return chunks
+}
+
+// estimateRowBytes: Ước lượng dung lượng JSON của 1 dòng (Đủ chính xác để chia Chunk)
+func estimateRowBytes(row []interface{}) int {
+	size := 2
+	for _, v := range row { size += len(SafeString(v)) + 4 }
+	return size
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// =================================================================================================
+// 📒 NHẬT KÝ GHI TRƯỚC (WRITE-AHEAD LOG) CHO WRITE QUEUE
+// =================================================================================================
+// - Mọi thay đổi vào Queue (QueueUpdate / QueueAppend) được ghi xuống file trước khi Handler trả lời.
+// - Ghi & fsync tách rời (Group Commit): Queue* chỉ Write (Nhanh, giữ QueueMutex), trả về journalTicket;
+//   Caller gọi Wait() SAU KHI nhả SheetMutex -> Nhiều Request dùng chung 1 lần fsync, không chặn Tenant khác.
+//   Wait() lỗi = Chưa bền -> Handler phải báo lỗi cho Tool.
+// - Server sập/OOM -> Lúc khởi động ReplayJournal() nạp lại Queue và ghi tiếp.
+// - Sau mỗi lần Flush, file được "nén" lại chỉ còn những gì CHƯA ghi thành công (Kể cả phần đang Flush dở).
+// - Append không lũy đẳng: Mỗi dòng mang Seq, Flush ghi mốc "applied" ngay khi Store nhận -> Replay bỏ qua dòng đã ghi.
+// - Mỗi spreadsheetId có 1 file riêng: <WAL_DIR>/<SafeIdent(sid)>.wal (JSON Lines)
+
+type JournalEntry struct {
+	Sid   string          `json:"sid"`
+	Op    string          `json:"op"` // "update" | "append" | "applied"
+	Sheet string          `json:"sheet"`
+	Row   int             `json:"row"`
+	Data  []interface{}   `json:"data,omitempty"`  // Bản cũ: Cả dòng (Vẫn đọc được khi Replay)
+	Cells RowCells        `json:"cells,omitempty"` // Các ô bẩn (Col -> Giá trị)
+	Rows  [][]interface{} `json:"rows,omitempty"`
+	Seqs  []int64         `json:"seqs,omitempty"` // Seq của từng dòng trong Rows
+	Seq   int64           `json:"seq,omitempty"`  // "applied": Mọi dòng Append của Sheet có Seq <= mốc này đã ghi xong
+}
+
+// journalFile: File WAL của 1 sid. f / written / synced / dirtyTail được bảo vệ bởi journal.Mutex.
+// syncMu: Chỉ 1 lần fsync mỗi lúc (Các Caller còn lại chờ rồi dùng chung kết quả).
+type journalFile struct {
+	syncMu    sync.Mutex
+	f         *os.File
+	written   int64 // Số lần Write đã thực hiện
+	synced    int64 // Mọi lần Write <= mốc này đã fsync
+	dirtyTail bool  // Lần Write trước lỗi giữa chừng -> Xuống dòng trước khi ghi tiếp
+	syncErr   error // Lỗi fsync khi đóng file lúc nén (Trả cho Caller còn chờ)
+}
+
+var journal = struct {
+	sync.Mutex
+	Files map[string]*journalFile
+}{
+	Files: make(map[string]*journalFile),
+}
+
+// journalTicket: Biên nhận của 1 lần ghi WAL
+type journalTicket struct {
+	jf  *journalFile
+	seq int64
+	err error
+}
+
+func journalDir() string {
+	if d := os.Getenv("WAL_DIR"); d != "" { return d }
+	return QUEUE.JOURNAL_DIR
+}
+
+func journalPath(sid string) string {
+	return filepath.Join(journalDir(), SafeIdent(sid)+".wal")
+}
+
+// journalFileLocked: Lấy (hoặc tạo) journalFile của sid. Yêu cầu đang giữ journal.Mutex.
+func journalFileLocked(sid string) *journalFile {
+	jf, ok := journal.Files[sid]
+	if !ok {
+		jf = &journalFile{}
+		journal.Files[sid] = jf
+	}
+	return jf
+}
+
+// journalWrite: Ghi các thay đổi xuống file (Chưa fsync). Gọi khi đang giữ STATE.QueueMutex (Giữ đúng thứ tự với Queue).
+func journalWrite(entries ...JournalEntry) journalTicket {
+	if len(entries) == 0 { return journalTicket{} }
+	var buf []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("❌ [WAL] Encode %s: %v", e.Sid, err)
+			return journalTicket{err: fmt.Errorf("WAL encode: %v", err)}
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	sid := entries[0].Sid
+
+	journal.Lock()
+	defer journal.Unlock()
+
+	jf := journalFileLocked(sid)
+	if jf.f == nil {
+		if err := os.MkdirAll(journalDir(), 0o755); err != nil {
+			log.Printf("❌ [WAL] Mkdir: %v", err)
+			return journalTicket{err: err}
+		}
+		f, err := os.OpenFile(journalPath(sid), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Printf("❌ [WAL] Open %s: %v", sid, err)
+			return journalTicket{err: err}
+		}
+		jf.f = f
+	}
+
+	if jf.dirtyTail { buf = append([]byte{'\n'}, buf...) } // Dòng hỏng phía trước bị Replay bỏ qua
+	if _, err := jf.f.Write(buf); err != nil {
+		log.Printf("❌ [WAL] Write %s: %v", sid, err)
+		jf.dirtyTail = true
+		return journalTicket{err: err}
+	}
+	jf.dirtyTail = false
+	jf.written++
+	return journalTicket{jf: jf, seq: jf.written}
+}
+
+// Wait: Chờ lần ghi đã fsync xong (Group Commit). KHÔNG gọi khi đang giữ SheetMutex / QueueMutex.
+func (t journalTicket) Wait() error {
+	if t.err != nil { return t.err }
+	if t.jf == nil { return nil }
+	jf := t.jf
+
+	jf.syncMu.Lock()
+	defer jf.syncMu.Unlock()
+
+	journal.Lock()
+	if jf.synced >= t.seq { journal.Unlock(); return nil }
+	f, target := jf.f, jf.written
+	if f == nil {
+		err := jf.syncErr
+		journal.Unlock()
+		if err == nil { err = fmt.Errorf("WAL đã đóng") }
+		return err
+	}
+	journal.Unlock()
+
+	if err := f.Sync(); err != nil {
+		log.Printf("❌ [WAL] Sync: %v", err)
+		return err
+	}
+	journal.Lock()
+	if jf.synced < target { jf.synced = target }
+	journal.Unlock()
+	return nil
+}
+
+// waitJournal: Chờ nhiều biên nhận, trả lỗi đầu tiên
+func waitJournal(tickets ...journalTicket) error {
+	var first error
+	for _, t := range tickets {
+		if err := t.Wait(); err != nil && first == nil { first = err }
+	}
+	return first
+}
+
+// journalCompact: Viết lại file chỉ còn nội dung Queue hiện tại (Phần chưa ghi thành công).
+// Gọi khi đang giữ STATE.QueueMutex để Queue và file luôn khớp nhau.
+// Lỗi ở bất kỳ bước nào -> Giữ nguyên file cũ (Replay có thể ghi lại Update đã xong: Vô hại, Append được lọc theo Seq).
+func journalCompact(sid string, q *WriteQueueData) {
+	journal.Lock()
+	jf := journalFileLocked(sid)
+	journal.Unlock()
+
+	jf.syncMu.Lock() // Không đóng file khi đang có fsync dở
+	defer jf.syncMu.Unlock()
+	journal.Lock()
+	defer journal.Unlock()
+
+	// Đóng file đang mở: fsync phần chưa bền trước (Nếu nén lỗi, file cũ vẫn phải đủ dữ liệu)
+	jf.syncErr = nil
+	if jf.f != nil {
+		if jf.synced < jf.written {
+			if err := jf.f.Sync(); err != nil {
+				log.Printf("❌ [WAL] Sync %s: %v", sid, err)
+				jf.syncErr = err
+			} else {
+				jf.synced = jf.written
+			}
+		}
+		jf.f.Close()
+		jf.f = nil
+		jf.dirtyTail = false
+	}
+
+	path := journalPath(sid)
+	if queueEmptyLocked(q) {
+		q.Applied = make(map[string]int64) // Không còn dòng chờ -> Mốc applied hết tác dụng
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("❌ [WAL] Truncate %s: %v", sid, err)
+			return
+		}
+		jf.synced, jf.syncErr = jf.written, nil
+		return
+	}
+
+	if err := writeJournalFile(path, journalSnapshot(sid, q)); err != nil {
+		log.Printf("❌ [WAL] Compact %s: %v (Giữ file cũ)", sid, err)
+		return
+	}
+	jf.synced, jf.syncErr = jf.written, nil // File mới đã fsync & chứa toàn bộ Queue
+}
+
+// queueEmptyLocked: Queue & bản đang Flush đều trống
+func queueEmptyLocked(q *WriteQueueData) bool {
+	return len(q.Updates) == 0 && len(q.Appends) == 0 && len(q.FlushUpdates) == 0 && len(q.FlushAppends) == 0
+}
+
+// journalSnapshot: Toàn bộ nội dung cần giữ trong WAL (Thứ tự: Mốc applied -> Đang Flush -> Queue mới hơn)
+func journalSnapshot(sid string, q *WriteQueueData) []JournalEntry {
+	var out []JournalEntry
+	for sheet, seq := range q.Applied {
+		out = append(out, JournalEntry{Sid: sid, Op: "applied", Sheet: sheet, Seq: seq})
+	}
+	addUpdates := func(updates map[string]map[int]RowCells) {
+		for sheet, rowMap := range updates {
+			for idx, cells := range rowMap {
+				out = append(out, JournalEntry{Sid: sid, Op: "update", Sheet: sheet, Row: idx, Cells: cells})
+			}
+		}
+	}
+	addAppends := func(appends map[string][][]interface{}, seqs map[string][]int64) {
+		for sheet, rows := range appends {
+			var keepRows [][]interface{}
+			var keepSeqs []int64
+			for i, row := range rows {
+				seq := int64(0)
+				if i < len(seqs[sheet]) { seq = seqs[sheet][i] }
+				if seq > 0 && seq <= q.Applied[sheet] { continue } // Store đã nhận
+				keepRows = append(keepRows, row)
+				keepSeqs = append(keepSeqs, seq)
+			}
+			if len(keepRows) > 0 {
+				out = append(out, JournalEntry{Sid: sid, Op: "append", Sheet: sheet, Rows: keepRows, Seqs: keepSeqs})
+			}
+		}
+	}
+	addUpdates(q.FlushUpdates)
+	addAppends(q.FlushAppends, q.FlushSeqs)
+	addUpdates(q.Updates)
+	addAppends(q.Appends, q.AppendSeqs)
+	return out
+}
+
+// writeJournalFile: Ghi ra file tạm, fsync, rồi Rename (Atomic). Chỉ Rename khi mọi bước thành công.
+func writeJournalFile(path string, entries []JournalEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return err }
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil { return err }
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err = enc.Encode(e); err != nil { break }
+	}
+	if err == nil { err = w.Flush() }
+	if err == nil { err = f.Sync() }
+	if cerr := f.Close(); err == nil { err = cerr }
+	if err == nil { err = os.Rename(tmp, path) }
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// readJournalFile: Đọc 1 file WAL. Dòng hỏng (Bị cắt ngang lúc sập) bị bỏ qua.
+func readJournalFile(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer f.Close()
+
+	var out []JournalEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		var e JournalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.Sid == "" { continue }
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
+
+// replayEntriesLocked: Nạp Entry vào Queue, bỏ dòng Append đã ghi (Seq <= mốc applied). Yêu cầu giữ QueueMutex.
+func replayEntriesLocked(entries []JournalEntry) int {
+	applied := make(map[string]map[string]int64) // sid -> sheet -> mốc
+	for _, e := range entries {
+		if e.Op != "applied" { continue }
+		if applied[e.Sid] == nil { applied[e.Sid] = make(map[string]int64) }
+		if e.Seq > applied[e.Sid][e.Sheet] { applied[e.Sid][e.Sheet] = e.Seq }
+	}
+
+	total := 0
+	for _, e := range entries {
+		q := getQueueLocked(e.Sid)
+		switch e.Op {
+		case "applied":
+			if e.Seq > q.Applied[e.Sheet] { q.Applied[e.Sheet] = e.Seq }
+			if e.Seq > q.LastSeq { q.LastSeq = e.Seq }
+			continue
+		case "append":
+			for i, row := range e.Rows {
+				seq := int64(0)
+				if i < len(e.Seqs) { seq = e.Seqs[i] }
+				if seq > q.LastSeq { q.LastSeq = seq }
+				if seq > 0 && seq <= applied[e.Sid][e.Sheet] { continue }
+				q.Appends[e.Sheet] = append(q.Appends[e.Sheet], row)
+				q.AppendSeqs[e.Sheet] = append(q.AppendSeqs[e.Sheet], seq)
+			}
+		default:
+			cells := e.Cells
+			if cells == nil {
+				cells = make(RowCells, len(e.Data))
+				for col, val := range e.Data { cells[col] = val }
+			}
+			mergeCellsLocked(q, e.Sheet, e.Row, cells, true)
+		}
+		total++
+	}
+	// Dòng cũ chưa có Seq (File WAL bản trước) -> Cấp Seq mới để lần nén sau không bị lọc nhầm
+	for _, q := range STATE.WriteQueue {
+		for sheet, seqs := range q.AppendSeqs {
+			for i := range seqs {
+				if seqs[i] == 0 { q.LastSeq++; seqs[i] = q.LastSeq }
+			}
+			q.AppendSeqs[sheet] = seqs
+		}
+	}
+	return total
+}
+
+// ReplayJournal: Chạy 1 lần lúc khởi động (main.go), nạp lại các thay đổi chưa kịp ghi.
+func ReplayJournal() {
+	files, err := filepath.Glob(filepath.Join(journalDir(), "*.wal"))
+	if err != nil || len(files) == 0 { return }
+
+	STATE.QueueMutex.Lock()
+	defer STATE.QueueMutex.Unlock()
+
+	var entries []JournalEntry
+	for _, path := range files {
+		list, err := readJournalFile(path)
+		if err != nil { log.Printf("❌ [WAL] Replay %s: %v", path, err) }
+		entries = append(entries, list...)
+	}
+	total := replayEntriesLocked(entries)
+
+	for sid, q := range STATE.WriteQueue {
+		journalCompact(sid, q)
+		scheduleFlushLocked(sid, q)
+	}
+	fmt.Printf("♻️ [WAL] Replayed %d pending entries from %d journal(s).\n", total, len(files))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// resetQueueForTest: WAL_DIR tạm + Queue trống + Store RAM (Flush hẹn giờ không đụng Google)
+func resetQueueForTest(t *testing.T) {
+	t.Helper()
+	t.Setenv("WAL_DIR", t.TempDir())
+	sheetStore = NewMemorySheetStore()
+	STATE.QueueMutex.Lock()
+	STATE.WriteQueue = make(map[string]*WriteQueueData)
+	STATE.QueueMutex.Unlock()
+	journal.Lock()
+	for _, jf := range journal.Files {
+		if jf.f != nil { jf.f.Close() }
+	}
+	journal.Files = make(map[string]*journalFile)
+	journal.Unlock()
+}
+
+func TestReplaySkipsAppliedAppends(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []JournalEntry
+		want    int // Số dòng Append còn lại sau Replay
+	}{
+		{"chưa ghi", []JournalEntry{
+			{Sid: "s", Op: "append", Sheet: "Log", Rows: [][]interface{}{{"a"}, {"b"}}, Seqs: []int64{1, 2}},
+		}, 2},
+		{"đã ghi hết", []JournalEntry{
+			{Sid: "s", Op: "append", Sheet: "Log", Rows: [][]interface{}{{"a"}, {"b"}}, Seqs: []int64{1, 2}},
+			{Sid: "s", Op: "applied", Sheet: "Log", Seq: 2},
+		}, 0},
+		{"ghi dở 1 chunk", []JournalEntry{
+			{Sid: "s", Op: "append", Sheet: "Log", Rows: [][]interface{}{{"a"}, {"b"}, {"c"}}, Seqs: []int64{1, 2, 3}},
+			{Sid: "s", Op: "applied", Sheet: "Log", Seq: 1},
+		}, 2},
+		{"mốc của Sheet khác", []JournalEntry{
+			{Sid: "s", Op: "append", Sheet: "Log", Rows: [][]interface{}{{"a"}}, Seqs: []int64{1}},
+			{Sid: "s", Op: "applied", Sheet: "Mail", Seq: 5},
+		}, 1},
+		{"WAL bản cũ không có Seq", []JournalEntry{
+			{Sid: "s", Op: "append", Sheet: "Log", Rows: [][]interface{}{{"a"}}},
+			{Sid: "s", Op: "applied", Sheet: "Log", Seq: 5},
+		}, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resetQueueForTest(t)
+			STATE.QueueMutex.Lock()
+			defer STATE.QueueMutex.Unlock()
+			replayEntriesLocked(tc.entries)
+			q := STATE.WriteQueue["s"]
+			if got := len(q.Appends["Log"]); got != tc.want { t.Fatalf("appends = %d, want %d", got, tc.want) }
+			if len(q.AppendSeqs["Log"]) != len(q.Appends["Log"]) { t.Fatalf("seqs không khớp rows") }
+			for _, seq := range q.AppendSeqs["Log"] {
+				if seq == 0 || seq <= q.Applied["Log"] { t.Fatalf("seq %d không hợp lệ (applied %d)", seq, q.Applied["Log"]) }
+			}
+		})
+	}
+}
+
+func TestJournalRoundTrip(t *testing.T) {
+	resetQueueForTest(t)
+	if err := QueueUpdateCells("s", "Data", 3, RowCells{1: "x"}).Wait(); err != nil { t.Fatal(err) }
+	if err := QueueAppend("s", "Log", [][]interface{}{{"r1"}, {"r2"}}).Wait(); err != nil { t.Fatal(err) }
+	if err := QueueUpdateCells("s", "Data", 3, RowCells{1: "y", 2: "z"}).Wait(); err != nil { t.Fatal(err) }
+
+	// Dòng cuối bị cắt ngang lúc sập -> Bỏ qua
+	f, err := os.OpenFile(journalPath("s"), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil { t.Fatal(err) }
+	f.WriteString(`{"sid":"s","op":"upd`)
+	f.Close()
+
+	entries, err := readJournalFile(journalPath("s"))
+	if err != nil { t.Fatal(err) }
+	if len(entries) != 3 { t.Fatalf("entries = %d, want 3", len(entries)) }
+
+	STATE.QueueMutex.Lock()
+	STATE.WriteQueue = make(map[string]*WriteQueueData)
+	replayEntriesLocked(entries)
+	q := STATE.WriteQueue["s"]
+	STATE.QueueMutex.Unlock()
+	if got := q.Updates["Data"][3]; got[1] != "y" || got[2] != "z" { t.Fatalf("updates = %v", got) }
+	if len(q.Appends["Log"]) != 2 { t.Fatalf("appends = %v", q.Appends["Log"]) }
+}
+
+func TestJournalCompact(t *testing.T) {
+	resetQueueForTest(t)
+	QueueAppend("s", "Log", [][]interface{}{{"r1"}, {"r2"}}).Wait()
+	path := journalPath("s")
+
+	STATE.QueueMutex.Lock()
+	q := STATE.WriteQueue["s"]
+
+	// Store đã nhận r1 -> Nén chỉ còn r2 (Kèm mốc applied)
+	q.Applied["Log"] = q.AppendSeqs["Log"][0]
+	journalCompact("s", q)
+	entries, _ := readJournalFile(path)
+	rows := 0
+	for _, e := range entries { rows += len(e.Rows) }
+	if rows != 1 { t.Fatalf("rows sau nén = %d, want 1", rows) }
+
+	// Không tạo được file tạm -> Giữ nguyên file cũ, không Rename
+	if err := os.Mkdir(path+".tmp", 0o755); err != nil { t.Fatal(err) }
+	q.Appends["Log"] = nil
+	q.AppendSeqs["Log"] = nil
+	q.Updates["Data"] = map[int]RowCells{1: {0: "x"}}
+	journalCompact("s", q)
+	after, _ := readJournalFile(path)
+	if len(after) != len(entries) { t.Fatalf("file cũ bị thay: %d -> %d entries", len(entries), len(after)) }
+	os.Remove(path + ".tmp")
+
+	// Queue trống -> Xóa file & mốc applied
+	q.Updates = make(map[string]map[int]RowCells)
+	q.Appends = make(map[string][][]interface{})
+	journalCompact("s", q)
+	STATE.QueueMutex.Unlock()
+	if _, err := os.Stat(path); !os.IsNotExist(err) { t.Fatalf("file còn tồn tại: %v", err) }
+	if len(q.Applied) != 0 { t.Fatalf("applied chưa xóa: %v", q.Applied) }
+}
+
+func TestJournalWaitAfterCompact(t *testing.T) {
+	resetQueueForTest(t)
+	ticket := QueueUpdateCells("s", "Data", 1, RowCells{0: "a"})
+
+	// Nén trước khi Caller kịp Wait -> Dữ liệu đã nằm trong file mới, Wait không lỗi
+	STATE.QueueMutex.Lock()
+	journalCompact("s", STATE.WriteQueue["s"])
+	STATE.QueueMutex.Unlock()
+	if err := ticket.Wait(); err != nil { t.Fatal(err) }
+
+	if err := QueueUpdateCells("s", "Data", 2, RowCells{0: "b"}).Wait(); err != nil { t.Fatal(err) }
+	entries, _ := readJournalFile(filepath.Join(journalDir(), SafeIdent("s")+".wal"))
+	if len(entries) != 2 { t.Fatalf("entries = %d, want 2", len(entries)) }
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =================================================================================================
+// ⏳ THUÊ NICK CÓ THỜI HẠN (LEASE) CHO /tool/login
+// =================================================================================================
+// - Chỉ áp dụng cho Tenant bật trong node Token Firebase: "lease": true | { "enabled": true, "ttl_ms": 300000 }.
+//   Tenant không bật -> Không cấp Lease, Reaper bỏ qua (Tool cũ không Heartbeat vẫn giữ nick như trước).
+// - Mỗi lần commit_and_response giao nick cho Device -> Cấp Lease hết hạn sau TTL (Mặc định LEASE.TTL_MS).
+// - Tool gọi /tool/heartbeat định kỳ để gia hạn. /tool/updated & /tool/log từ đúng Device cũng gia hạn.
+// - Reaper (chạy nền) thu hồi Lease quá hạn: Trả nick về "Đang chờ"/"Chờ đăng ký" và gỡ DeviceId.
+// - Lease chỉ nằm trong RAM. Sau Restart (hoặc nick bị sửa tay), nick "Đang chạy" chưa có Lease
+//   sẽ được Reaper cấp Lease mới (Ân hạn 1 TTL) thay vì thu hồi ngay.
+
+type Lease struct {
+	DeviceId  string
+	ExpiresAt int64 // Unix ms
+}
+
+// leases: sid -> RowIndex (Cache) -> Lease. Thứ tự khóa: STATE.SheetMutex -> leases.
+var leases = struct {
+	sync.Mutex
+	Rows map[string]map[int]*Lease
+}{
+	Rows: make(map[string]map[int]*Lease),
+}
+
+var leaseSettings = struct {
+	sync.RWMutex
+	TTL map[string]int64 // sid -> Thời hạn thuê (ms). Không có = Tenant không bật Lease
+}{
+	TTL: make(map[string]int64),
+}
+
+// rememberLease: Ghi nhận cấu hình Lease từ Token (Gọi trong AuthMiddleware)
+func rememberLease(sid string, data map[string]interface{}) {
+	enabled, ttl := false, LEASE.TTL_MS
+	switch v := data["lease"].(type) {
+	case bool:
+		enabled = v
+	case map[string]interface{}:
+		enabled = true
+		if on, ok := v["enabled"].(bool); ok { enabled = on }
+		if n, ok := toFloat(v["ttl_ms"]); ok && int64(n) >= LEASE.MIN_TTL_MS { ttl = int64(n) }
+	}
+
+	leaseSettings.Lock()
+	if enabled { leaseSettings.TTL[sid] = ttl } else { delete(leaseSettings.TTL, sid) }
+	leaseSettings.Unlock()
+}
+
+// leaseTTL: Thời hạn thuê của Tenant. ok = false -> Tenant không bật Lease
+func leaseTTL(sid string) (int64, bool) {
+	leaseSettings.RLock()
+	defer leaseSettings.RUnlock()
+	ttl, ok := leaseSettings.TTL[sid]
+	return ttl, ok
+}
+
+// grantLease: Cấp mới / gia hạn Lease của 1 dòng. Tenant không bật Lease -> 0
+func grantLease(sid string, idx int, deviceId string) int64 {
+	ttl, ok := leaseTTL(sid)
+	if !ok { return 0 }
+	leases.Lock()
+	defer leases.Unlock()
+
+	if leases.Rows[sid] == nil { leases.Rows[sid] = make(map[int]*Lease) }
+	exp := time.Now().UnixMilli() + ttl
+	leases.Rows[sid][idx] = &Lease{DeviceId: deviceId, ExpiresAt: exp}
+	return exp
+}
+
+// dropLease: Bỏ Lease (Nick đã được trả / chuyển trạng thái)
+func dropLease(sid string, idx int) {
+	leases.Lock()
+	defer leases.Unlock()
+
+	delete(leases.Rows[sid], idx)
+	if len(leases.Rows[sid]) == 0 { delete(leases.Rows, sid) }
+}
+
+// touchLeases: Gia hạn Lease đang có của Device (/tool/updated, /tool/log). rows rỗng = Mọi nick của Device.
+// Chỉ gia hạn Lease sẵn có & đúng thiết bị, không cấp mới.
+func touchLeases(sid, deviceId string, rows ...int) {
+	ttl, ok := leaseTTL(sid)
+	if !ok || deviceId == "" { return }
+	leases.Lock()
+	defer leases.Unlock()
+
+	exp := time.Now().UnixMilli() + ttl
+	extend := func(l *Lease) { if l != nil && sameDevice(l.DeviceId, deviceId) && l.ExpiresAt < exp { l.ExpiresAt = exp } }
+	if len(rows) == 0 {
+		for _, l := range leases.Rows[sid] { extend(l) }
+		return
+	}
+	for _, idx := range rows { extend(leases.Rows[sid][idx]) }
+}
+
+// isLeasedStatus: Trạng thái đang giữ nick (Cần Lease)
+func isLeasedStatus(cleanStatus string) bool {
+	return cleanStatus == STATUS_READ.RUNNING || cleanStatus == STATUS_READ.REGISTERING
+}
+
+// HeartbeatLeases: Gia hạn các nick Device đang giữ. rowIdx < 0 = Tất cả nick của Device.
+// explicitSlot (Body có "slot", kể cả 1) -> Chỉ gia hạn đúng Slot đó, không có -> Mọi Slot của thiết bị.
+// Trả về danh sách row_index (Theo Sheet) đã gia hạn & mốc hết hạn mới.
+func HeartbeatLeases(sid, devKey string, explicitSlot bool, rowIdx int) ([]int, int64, error) {
+	if _, ok := leaseTTL(sid); !ok { return nil, 0, fmt.Errorf("Tenant chưa bật thuê nick (lease)") }
+	cacheData, err := LayDuLieu(sid, SHEET_NAMES.DATA_TIKTOK, false)
+	if err != nil { return nil, 0, fmt.Errorf("Lỗi tải dữ liệu") }
+
+	STATE.SheetMutex.RLock()
+	defer STATE.SheetMutex.RUnlock()
+
+	var rows []int
+	var exp int64
+	for _, st := range []string{STATUS_READ.RUNNING, STATUS_READ.REGISTERING} {
+		for _, idx := range cacheData.StatusMap[st] {
+			if idx >= len(cacheData.CleanValues) { continue }
+			cell := cacheData.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID]
+			if !ownsSlot(cell, devKey, explicitSlot) { continue }
+			if rowIdx >= 0 && idx != rowIdx { continue }
+			exp = grantLease(sid, idx, cell)
+			rows = append(rows, RANGES.DATA_START_ROW+idx)
+		}
+	}
+	if len(rows) == 0 { return nil, 0, fmt.Errorf("Thiết bị không còn giữ nick nào (Đã bị thu hồi)") }
+	return rows, exp, nil
+}
+
+// RunLeaseReaper: Chạy nền (main.go). Mỗi LEASE.REAP_MS quét & thu hồi Lease quá hạn.
+func RunLeaseReaper() {
+	ticker := time.NewTicker(time.Duration(LEASE.REAP_MS) * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		suffix := KEY_SEPARATOR + SHEET_NAMES.DATA_TIKTOK
+		var sids []string
+		STATE.SheetMutex.RLock()
+		for k := range STATE.SheetCache {
+			if strings.HasSuffix(k, suffix) { sids = append(sids, strings.TrimSuffix(k, suffix)) }
+		}
+		STATE.SheetMutex.RUnlock()
+
+		for _, sid := range sids { reapLeases(sid) }
+	}
+}
+
+// reapLeases: Đối chiếu Lease với Cache của 1 sid. Tenant không bật Lease -> Bỏ Lease cũ, không thu hồi.
+func reapLeases(sid string) {
+	ttl, enabled := leaseTTL(sid)
+	if !enabled {
+		leases.Lock()
+		delete(leases.Rows, sid)
+		leases.Unlock()
+		return
+	}
+	var ticket journalTicket
+	defer func() { ticket.Wait() }() // fsync WAL sau khi nhả SheetMutex
+	STATE.SheetMutex.Lock()
+	defer STATE.SheetMutex.Unlock()
+
+	cache, ok := STATE.SheetCache[sid+KEY_SEPARATOR+SHEET_NAMES.DATA_TIKTOK]
+	if !ok { return }
+	now := time.Now().UnixMilli()
+
+	leases.Lock()
+	current := leases.Rows[sid]
+	if current == nil { current = make(map[int]*Lease); leases.Rows[sid] = current }
+
+	// 1. Bỏ Lease của nick không còn bị giữ (Đã trả, đổi trạng thái, đổi Device...)
+	for idx, l := range current {
+		if idx >= len(cache.CleanValues) || !isLeasedStatus(cache.CleanValues[idx][INDEX_DATA_TIKTOK.STATUS]) ||
+			cache.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID] != l.DeviceId {
+			delete(current, idx)
+		}
+	}
+
+	// 2. Nick đang giữ nhưng chưa có Lease -> Cấp ân hạn. Đã có & quá hạn -> Thu hồi.
+	var expired []int
+	for _, st := range []string{STATUS_READ.RUNNING, STATUS_READ.REGISTERING} {
+		for _, idx := range cache.StatusMap[st] {
+			if idx >= len(cache.CleanValues) { continue }
+			dev := cache.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID]
+			if dev == "" { continue }
+			l, ok := current[idx]
+			if !ok {
+				current[idx] = &Lease{DeviceId: dev, ExpiresAt: now + ttl}
+				continue
+			}
+			if now >= l.ExpiresAt {
+				expired = append(expired, idx)
+				delete(current, idx)
+			}
+		}
+	}
+	if len(current) == 0 { delete(leases.Rows, sid) }
+	leases.Unlock()
+
+	reclaimed := make(map[int]RowCells)
+	for _, idx := range expired {
+		st := STATUS_WRITE.WAITING
+		if cache.CleanValues[idx][INDEX_DATA_TIKTOK.STATUS] == STATUS_READ.REGISTERING { st = STATUS_WRITE.WAIT_REG }
+		dev := cache.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID]
+		note := tao_ghi_chu_chuan_login(SafeString(cache.RawValues[idx][INDEX_DATA_TIKTOK.NOTE]), "Thu hồi (Mất kết nối)", "normal")
+
+		dirty := updateRowCache(cache, idx, st, note, "")
+		for col, val := range clearRowDevice(cache, idx) { dirty[col] = val }
+		reclaimed[idx] = dirty
+		fmt.Printf("⏳ [LEASE] %s: Thu hồi dòng %d của %s (Hết hạn thuê).\n", sid, RANGES.DATA_START_ROW+idx, dev)
+	}
+	ticket = QueueUpdateRows(sid, SHEET_NAMES.DATA_TIKTOK, reclaimed)
+}
+
+// clearRowDevice: Gỡ DeviceId khỏi dòng (updateRowCache bỏ qua giá trị rỗng). Yêu cầu giữ SheetMutex.
+func clearRowDevice(cache *SheetCacheData, idx int) RowCells {
+	oldDev := cache.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID]
+	if oldDev == "" { return nil }
+	cache.RawValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID] = ""
+	cache.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID] = ""
+	reindexDevice(cache, idx, oldDev, "")
+	return RowCells{INDEX_DATA_TIKTOK.DEVICE_ID: ""}
+}
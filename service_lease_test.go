@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// leaseRow: Dòng DataTiktok "Đang chạy" thuộc Device dev
+func leaseRow(dev string) []interface{} {
+	row := make([]interface{}, INDEX_DATA_TIKTOK.COOKIE+1)
+	for i := range row { row[i] = "" }
+	row[INDEX_DATA_TIKTOK.STATUS] = STATUS_WRITE.RUNNING
+	row[INDEX_DATA_TIKTOK.DEVICE_ID] = dev
+	return row
+}
+
+// setLease: Bật / tắt Lease của Tenant như khi AuthMiddleware đọc Token
+func setLease(t *testing.T, sid string, lease interface{}) {
+	t.Helper()
+	data := map[string]interface{}{}
+	if lease != nil { data["lease"] = lease }
+	rememberLease(sid, data)
+	t.Cleanup(func() {
+		rememberLease(sid, map[string]interface{}{})
+		leases.Lock()
+		delete(leases.Rows, sid)
+		leases.Unlock()
+	})
+}
+
+// expireLease: Đẩy mốc hết hạn của 1 dòng về quá khứ
+func expireLease(sid string, idx int) {
+	leases.Lock()
+	if l := leases.Rows[sid][idx]; l != nil { l.ExpiresAt = time.Now().UnixMilli() - 1 }
+	leases.Unlock()
+}
+
+func leaseStatus(cache *SheetCacheData, idx int) string {
+	STATE.SheetMutex.RLock()
+	defer STATE.SheetMutex.RUnlock()
+	return cache.CleanValues[idx][INDEX_DATA_TIKTOK.STATUS]
+}
+
+func TestLeaseOptIn(t *testing.T) {
+	resetQueueForTest(t)
+	cache := cachedDataSheet(t, "s", [][]interface{}{leaseRow("dev")})
+	setLease(t, "s", nil)
+
+	// Tenant không bật: Không cấp Lease, Reaper không thu hồi dù Tool không Heartbeat
+	if exp := grantLease("s", 0, "dev"); exp != 0 { t.Fatalf("grantLease = %d, want 0", exp) }
+	reapLeases("s")
+	reapLeases("s")
+	if got := leaseStatus(cache, 0); got != STATUS_READ.RUNNING { t.Fatalf("status = %q, không được thu hồi", got) }
+	if _, _, err := HeartbeatLeases("s", "dev", false, -1); err == nil { t.Fatal("Heartbeat khi chưa bật Lease phải lỗi") }
+
+	// Bật Lease: Hết hạn -> Thu hồi & gỡ DeviceId
+	setLease(t, "s", map[string]interface{}{"ttl_ms": 120000.0})
+	if ttl, ok := leaseTTL("s"); !ok || ttl != 120000 { t.Fatalf("leaseTTL = %d, %v", ttl, ok) }
+	if exp := grantLease("s", 0, "dev"); exp == 0 { t.Fatal("grantLease phải cấp Lease") }
+	expireLease("s", 0)
+	reapLeases("s")
+	if got := leaseStatus(cache, 0); got != STATUS_READ.WAITING { t.Fatalf("status = %q, want %q", got, STATUS_READ.WAITING) }
+	if dev := cache.CleanValues[0][INDEX_DATA_TIKTOK.DEVICE_ID]; dev != "" { t.Fatalf("DeviceId = %q, phải được gỡ", dev) }
+}
+
+func TestTouchLeasesExtendsOwner(t *testing.T) {
+	tests := []struct {
+		name    string
+		touch   func()
+		reclaim bool
+	}{
+		{"không gia hạn", func() {}, true},
+		{"/tool/updated đúng Device", func() { touchLeases("s", "dev", 0) }, false},
+		{"/tool/updated dòng khác", func() { touchLeases("s", "dev", 1) }, true},
+		{"/tool/log đúng Device (Slot khác)", func() { touchLeases("s", "dev#2") }, false},
+		{"/tool/log Device khác", func() { touchLeases("s", "other") }, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resetQueueForTest(t)
+			cache := cachedDataSheet(t, "s", [][]interface{}{leaseRow("dev")})
+			setLease(t, "s", true)
+			grantLease("s", 0, "dev")
+			expireLease("s", 0)
+			tc.touch()
+			reapLeases("s")
+			if reclaimed := leaseStatus(cache, 0) == STATUS_READ.WAITING; reclaimed != tc.reclaim {
+				t.Fatalf("thu hồi = %v, want %v", reclaimed, tc.reclaim)
+			}
+		})
+	}
+}
+
+func TestReclaimedStepsOnlyWithLease(t *testing.T) {
+	hasReclaimed := func(f Funnel) bool {
+		for _, s := range f.Steps {
+			if s.Status == STATUS_READ.WAITING && s.Owner == "unassigned" { return true }
+		}
+		return false
+	}
+	td := &TokenData{SpreadsheetID: "s", Data: map[string]interface{}{}}
+
+	setLease(t, "s", false)
+	if f, _ := resolveFunnel(td, "login"); hasReclaimed(f) { t.Fatal("Tenant không bật Lease: Giữ phễu mặc định") }
+	setLease(t, "s", true)
+	f, _ := resolveFunnel(td, "login")
+	if !hasReclaimed(f) { t.Fatal("Tenant bật Lease: Phải lấy nick bị thu hồi") }
+	if len(DEFAULT_FUNNELS["login"].Steps) != 4 { t.Fatal("DEFAULT_FUNNELS bị sửa") }
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =================================================================================================
+// ⏰ THEO DÕI HẠN PROXY (PROXY_EXPIRED)
+// =================================================================================================
+// - Chạy nền mỗi PROXY_WATCH.CHECK_MS: Đọc PROXY_EXPIRED (parseSmartTime) của mọi DataTiktok đang Cache,
+//   đánh dấu nick có Proxy đã / sắp hết hạn (Trong PROXY_WATCH.FLAG_WINDOW_MS).
+// - Nick bị đánh dấu không được cấp ở /tool/login (Trừ Tenant bật kho Proxy: Nick sẽ được đổi Proxy mới).
+// - Dấu chỉ nằm trong RAM, tính lại mỗi lượt quét. PROXY_EXPIRED trống = Không thời hạn (Không đánh dấu).
+// - /tool/proxy-report: Danh sách nick & Proxy trong kho sắp hết hạn.
+
+var proxyFlags = struct {
+	sync.RWMutex
+	Rows map[string]map[int]int64 // sid -> RowIndex (Cache) -> Mốc hết hạn (Unix ms, 0 = Sai định dạng)
+}{
+	Rows: make(map[string]map[int]int64),
+}
+
+// RunProxyWatcher: Chạy nền (main.go)
+func RunProxyWatcher() {
+	ticker := time.NewTicker(time.Duration(PROXY_WATCH.CHECK_MS) * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		suffix := KEY_SEPARATOR + SHEET_NAMES.DATA_TIKTOK
+		var sids []string
+		STATE.SheetMutex.RLock()
+		for k := range STATE.SheetCache {
+			if strings.HasSuffix(k, suffix) { sids = append(sids, strings.TrimSuffix(k, suffix)) }
+		}
+		STATE.SheetMutex.RUnlock()
+
+		for _, sid := range sids { scanProxyExpiry(sid) }
+	}
+}
+
+// scanProxyExpiry: Tính lại danh sách nick bị đánh dấu của 1 sid
+func scanProxyExpiry(sid string) {
+	deadline := time.Now().Add(time.Duration(PROXY_WATCH.FLAG_WINDOW_MS) * time.Millisecond)
+	flags := make(map[int]int64)
+
+	STATE.SheetMutex.RLock()
+	cache, ok := STATE.SheetCache[sid+KEY_SEPARATOR+SHEET_NAMES.DATA_TIKTOK]
+	if ok {
+		for idx, row := range cache.RawValues {
+			if cache.CleanValues[idx][INDEX_DATA_TIKTOK.PROXY] == "" { continue }
+			exp := gs(row, INDEX_DATA_TIKTOK.PROXY_EXPIRED)
+			if proxyExpired(exp, deadline) { flags[idx] = expiryMillis(exp) }
+		}
+	}
+	STATE.SheetMutex.RUnlock()
+	if !ok { return }
+
+	proxyFlags.Lock()
+	newly := 0
+	for idx := range flags {
+		if _, seen := proxyFlags.Rows[sid][idx]; !seen { newly++ }
+	}
+	if len(flags) == 0 { delete(proxyFlags.Rows, sid) } else { proxyFlags.Rows[sid] = flags }
+	proxyFlags.Unlock()
+
+	if newly > 0 { fmt.Printf("⚠️ [PROXY] %s: %d nick có Proxy sắp hết hạn (Tổng %d).\n", sid, newly, len(flags)) }
+}
+
+// proxyFlagged: Nick đang bị đánh dấu Proxy hết hạn
+func proxyFlagged(sid string, idx int) bool {
+	proxyFlags.RLock()
+	defer proxyFlags.RUnlock()
+	_, ok := proxyFlags.Rows[sid][idx]
+	return ok
+}
+
+// unflagProxy: Bỏ dấu (Nick vừa được cấp Proxy mới)
+func unflagProxy(sid string, idx int) {
+	proxyFlags.Lock()
+	defer proxyFlags.Unlock()
+	delete(proxyFlags.Rows[sid], idx)
+}
+
+// expiryMillis: Mốc hết hạn (Unix ms), 0 nếu sai định dạng
+func expiryMillis(exp string) int64 {
+	t := parseSmartTime(exp)
+	if t.IsZero() { return 0 }
+	return t.UnixMilli()
+}
+
+type ProxyExpiryItem struct {
+	RowIndex     int    `json:"row_index,omitempty"`
+	Status       string `json:"status,omitempty"`
+	DeviceId     string `json:"device_id,omitempty"`
+	Proxy        string `json:"proxy"`
+	ProxyExpired string `json:"proxy_expired"`
+	ExpiresAt    int64  `json:"expires_at"`
+	Expired      bool   `json:"expired"`
+	Flagged      bool   `json:"flagged,omitempty"`
+}
+
+// ProxyExpiryReport: Nick & Proxy trong kho hết hạn trước now + window
+func ProxyExpiryReport(sid string, window time.Duration) ([]ProxyExpiryItem, []ProxyExpiryItem, error) {
+	cache, err := LayDuLieu(sid, SHEET_NAMES.DATA_TIKTOK, false)
+	if err != nil { return nil, nil, fmt.Errorf("Lỗi tải dữ liệu") }
+	pool, _ := loadProxyPool(sid)
+
+	now := time.Now()
+	deadline := now.Add(window)
+	item := func(proxy, exp string) (ProxyExpiryItem, bool) {
+		if strings.TrimSpace(proxy) == "" || !proxyExpired(exp, deadline) { return ProxyExpiryItem{}, false }
+		at := expiryMillis(exp)
+		return ProxyExpiryItem{Proxy: proxy, ProxyExpired: exp, ExpiresAt: at, Expired: at <= now.UnixMilli()}, true
+	}
+
+	STATE.SheetMutex.RLock()
+	accounts := []ProxyExpiryItem{}
+	for idx, row := range cache.RawValues {
+		it, ok := item(gs(row, INDEX_DATA_TIKTOK.PROXY), gs(row, INDEX_DATA_TIKTOK.PROXY_EXPIRED))
+		if !ok { continue }
+		it.RowIndex = RANGES.DATA_START_ROW + idx
+		it.Status = gs(row, INDEX_DATA_TIKTOK.STATUS)
+		it.DeviceId = gs(row, INDEX_DATA_TIKTOK.DEVICE_ID)
+		it.Flagged = proxyFlagged(sid, idx)
+		accounts = append(accounts, it)
+	}
+	proxies := []ProxyExpiryItem{}
+	if pool != nil {
+		for i, row := range pool.RawValues {
+			it, ok := item(gs(row, INDEX_PROXY.PROXY), gs(row, INDEX_PROXY.EXPIRED))
+			if !ok { continue }
+			it.RowIndex = RANGES.DATA_START_ROW + i
+			proxies = append(proxies, it)
+		}
+	}
+	STATE.SheetMutex.RUnlock()
+
+	for _, list := range [][]ProxyExpiryItem{accounts, proxies} {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].ExpiresAt < list[j].ExpiresAt })
+	}
+	return accounts, proxies, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// =================================================================================================
+// 📊 HẠN MỨC HOẠT ĐỘNG TRONG NGÀY (POST / FOLLOW)
+// =================================================================================================
+// - Cột DAILY_*_LIMIT: Giới hạn / ngày. Trống hoặc <= 0 = Không giới hạn.
+// - Cột TODAY_*_COUNT: Đã dùng hôm nay. Đọc thẳng giá trị trong cột, kể cả số Tool ghi qua /tool/updated.
+//   Việc đưa về 0 lúc sang ngày do Reset hằng ngày đảm nhiệm (service_daily.go), không suy từ LAST_ACTIVE_DATE.
+// - /tool/counter cộng số đếm & ghi LAST_ACTIVE_DATE = Hôm nay (Mốc hoạt động cho Xoay vòng LRU).
+
+// quotaCols: Cột giới hạn & cột đếm theo loại hoạt động
+func quotaCols(activity string) (limitCol, countCol int, ok bool) {
+	switch activity {
+	case "post":
+		return INDEX_DATA_TIKTOK.DAILY_POST_LIMIT, INDEX_DATA_TIKTOK.TODAY_POST_COUNT, true
+	case "follow":
+		return INDEX_DATA_TIKTOK.DAILY_FOLLOW_LIMIT, INDEX_DATA_TIKTOK.TODAY_FOLLOW_COUNT, true
+	}
+	return 0, 0, false
+}
+
+// quotaToday: Ngày hiện tại theo múi giờ của Tenant (Cùng định dạng với Note)
+func quotaToday(sid string) string {
+	return tenantNow(sid).Format("02/01/2006")
+}
+
+// quotaUsage: Số đã dùng hôm nay & giới hạn (limit <= 0 = Không giới hạn)
+func quotaUsage(sid string, row []interface{}, activity string) (used, limit int) {
+	limitCol, countCol, ok := quotaCols(activity)
+	if !ok { return 0, 0 }
+	if l, ok := getFloatVal(row, limitCol); ok { limit = int(l) }
+	if c, ok := getFloatVal(row, countCol); ok { used = int(c) }
+	return used, limit
+}
+
+// hasQuota: Nick còn hạn mức cho hoạt động này không
+func hasQuota(sid string, row []interface{}, activity string) bool {
+	used, limit := quotaUsage(sid, row, activity)
+	return limit <= 0 || used < limit
+}
+
+// IncrementQuota: Cộng số đếm (Atomic trong SheetMutex). Vượt giới hạn -> Từ chối, không cộng.
+func IncrementQuota(sid string, idx int, deviceId, activity string, amount int) (res map[string]interface{}, err error) {
+	if _, _, ok := quotaCols(activity); !ok { return nil, fmt.Errorf("Activity không hợp lệ (post | follow)") }
+	if amount <= 0 { amount = 1 }
+
+	cacheData, err := LayDuLieu(sid, SHEET_NAMES.DATA_TIKTOK, false)
+	if err != nil { return nil, fmt.Errorf("Lỗi tải dữ liệu") }
+
+	var ticket journalTicket
+	defer func() { // Chạy sau khi nhả SheetMutex
+		if err == nil && ticket.Wait() != nil { res, err = nil, fmt.Errorf("Lỗi ghi nhật ký (WAL), thử lại") }
+	}()
+	STATE.SheetMutex.Lock()
+	defer STATE.SheetMutex.Unlock()
+
+	if idx < 0 || idx >= len(cacheData.RawValues) { return nil, fmt.Errorf("Row không tồn tại") }
+	if deviceId != "" && !sameDevice(cacheData.CleanValues[idx][INDEX_DATA_TIKTOK.DEVICE_ID], deviceId) { return nil, fmt.Errorf("Nick không thuộc thiết bị này") }
+
+	row := cacheData.RawValues[idx]
+	used, limit := quotaUsage(sid, row, activity)
+	if limit > 0 && used+amount > limit {
+		return nil, fmt.Errorf("Đã đạt giới hạn %s trong ngày (%d/%d)", activity, used, limit)
+	}
+
+	dirty := make(RowCells)
+	if today := quotaToday(sid); !strings.HasPrefix(gs(row, INDEX_DATA_TIKTOK.LAST_ACTIVE_DATE), today) {
+		setRowCell(cacheData, idx, INDEX_DATA_TIKTOK.LAST_ACTIVE_DATE, today, dirty)
+	}
+	_, countCol, _ := quotaCols(activity)
+	setRowCell(cacheData, idx, countCol, float64(used+amount), dirty) // float64 giống số đọc từ Sheet
+	ticket = QueueUpdateCells(sid, SHEET_NAMES.DATA_TIKTOK, idx, dirty)
+
+	remaining := -1
+	if limit > 0 { remaining = limit - used - amount }
+	return map[string]interface{}{
+		"status": "true", "messenger": "Đã cập nhật", "row_index": RANGES.DATA_START_ROW + idx,
+		"activity": activity, "count": used + amount, "limit": limit, "remaining": remaining,
+	}, nil
+}
+
+// setRowCell: Ghi 1 ô vào Cache (Tự nới dòng) và ghi nhận vào dirty. Yêu cầu giữ SheetMutex (Write).
+func setRowCell(cache *SheetCacheData, idx, col int, val interface{}, dirty RowCells) {
+	for len(cache.RawValues[idx]) <= col { cache.RawValues[idx] = append(cache.RawValues[idx], "") }
+	cache.RawValues[idx][col] = val
+	if col < CACHE.CLEAN_COL_LIMIT { cache.CleanValues[idx][col] = CleanString(val) }
+	dirty[col] = val
+}
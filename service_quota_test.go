@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+// quotaRow: Dòng DataTiktok giới hạn post = limit, ngày hoạt động cuối = lastActive
+func quotaRow(limit float64, lastActive string) []interface{} {
+	row := countRow(0, 0, lastActive)
+	row[INDEX_DATA_TIKTOK.DAILY_POST_LIMIT] = limit
+	row[INDEX_DATA_TIKTOK.DEVICE_ID] = "dev"
+	return row
+}
+
+func TestQuotaCountsWithoutLastActiveDate(t *testing.T) {
+	yesterday := tenantNow("s").AddDate(0, 0, -1).Format("02/01/2006")
+	admin := ScopeSet{SCOPES.ADMIN: true}
+
+	t.Run("/tool/updated ghi TODAY_*", func(t *testing.T) {
+		resetQueueForTest(t)
+		cache := cachedDataSheet(t, "s", [][]interface{}{quotaRow(2, yesterday)})
+		body := map[string]interface{}{
+			"row_index": float64(RANGES.DATA_START_ROW),
+			"updated":   map[string]interface{}{"col_" + strconv.Itoa(INDEX_DATA_TIKTOK.TODAY_POST_COUNT): 2.0},
+		}
+		if _, err := xu_ly_update_logic("s", "dev", "updated", body, admin); err != nil { t.Fatal(err) }
+		if hasQuota("s", cache.RawValues[0], "post") { t.Fatal("TODAY_POST_COUNT = giới hạn -> Hết hạn mức dù LAST_ACTIVE_DATE cũ") }
+		if _, err := IncrementQuota("s", 0, "dev", "post", 1); err == nil { t.Fatal("/tool/counter phải từ chối") }
+	})
+
+	t.Run("/tool/counter", func(t *testing.T) {
+		resetQueueForTest(t)
+		today := quotaToday("s")
+		cache := cachedDataSheet(t, "s", [][]interface{}{quotaRow(2, yesterday)})
+		res, err := IncrementQuota("s", 0, "dev", "post", 1)
+		if err != nil || res["count"] != 1 { t.Fatalf("lần 1 = %v, %v", res, err) }
+		if got := gs(cache.RawValues[0], INDEX_DATA_TIKTOK.LAST_ACTIVE_DATE); got != today { t.Fatalf("LAST_ACTIVE_DATE = %q, want %q", got, today) }
+		if res, err = IncrementQuota("s", 0, "dev", "post", 1); err != nil || res["remaining"] != 0 { t.Fatalf("lần 2 = %v, %v", res, err) }
+		if _, err := IncrementQuota("s", 0, "dev", "post", 1); err == nil { t.Fatal("vượt giới hạn phải từ chối") }
+		if _, err := IncrementQuota("s", 0, "other", "post", 1); err == nil { t.Fatal("Device khác phải từ chối") }
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// =================================================================================================
+// 🔁 XOAY VÒNG & THỜI GIAN NGHỈ (ROTATION / COOLDOWN) CHO PHỄU ƯU TIÊN
+// =================================================================================================
+// Mặc định phễu quét StatusMap theo thứ tự Sheet -> Các dòng đầu bị dùng lặp lại mãi.
+// Chế độ (Mode):
+//   - "sequential"  : Giữ nguyên như cũ
+//   - "round_robin" : Tiếp tục sau dòng vừa cấp gần nhất (Theo từng Status)
+//   - "lru"         : Nick lâu chưa chạy nhất trước (LAST_ACTIVE_DATE, rồi tới giờ trong Note)
+//   - "random"      : Ngẫu nhiên
+// Cooldown: Bỏ qua nick vừa chạy cách đây < N phút (Giờ trong dòng 2 của Note).
+//           Không áp dụng cho nick đang giữ ("Đang chạy"/"Đang đăng ký").
+// Nguồn cấu hình: Body { "rotation": "lru", "cooldown_minutes": 30 } > Token Firebase "rotation": {...} > ROTATION mặc định.
+
+type RotationPolicy struct {
+	Mode        string
+	CooldownMin int
+}
+
+var rotationCursors = struct {
+	sync.Mutex
+	Last map[string]int // sid__status -> RowIndex vừa cấp
+}{
+	Last: make(map[string]int),
+}
+
+// resolveRotation: Body > Tenant > Mặc định
+func resolveRotation(tokenData *TokenData, body map[string]interface{}) (RotationPolicy, error) {
+	p := RotationPolicy{Mode: ROTATION.DEFAULT_MODE, CooldownMin: ROTATION.DEFAULT_COOLDOWN_MIN}
+	if tokenData != nil {
+		if m, ok := tokenData.Data["rotation"].(map[string]interface{}); ok {
+			if mode := CleanString(m["mode"]); mode != "" { p.Mode = mode }
+			if v, ok := toFloat(m["cooldown_minutes"]); ok { p.CooldownMin = int(v) }
+		}
+	}
+	if mode := CleanString(body["rotation"]); mode != "" { p.Mode = mode }
+	if v, ok := toFloat(body["cooldown_minutes"]); ok { p.CooldownMin = int(v) }
+
+	switch p.Mode {
+	case "sequential", "round_robin", "lru", "random":
+		return p, nil
+	}
+	return p, fmt.Errorf("Rotation không hợp lệ (sequential | round_robin | lru | random)")
+}
+
+// orderCandidates: Trả về bản sao danh sách index theo chính sách (Không sửa StatusMap). Yêu cầu giữ SheetMutex.
+func orderCandidates(sid, status string, indices []int, cache *SheetCacheData, p RotationPolicy) []int {
+	list := make([]int, 0, len(indices))
+	held := isLeasedStatus(status)
+	now := time.Now()
+	for _, idx := range indices {
+		if idx >= len(cache.RawValues) { continue }
+		if p.CooldownMin > 0 && !held {
+			if last := lastRunTime(cache.RawValues[idx]); !last.IsZero() && now.Sub(last) < time.Duration(p.CooldownMin)*time.Minute { continue }
+		}
+		list = append(list, idx)
+	}
+
+	switch p.Mode {
+	case "round_robin":
+		sort.Ints(list)
+		rotationCursors.Lock()
+		last, ok := rotationCursors.Last[sid+KEY_SEPARATOR+status]
+		rotationCursors.Unlock()
+		if ok {
+			cut := sort.SearchInts(list, last+1)
+			list = append(list[cut:], list[:cut]...)
+		}
+	case "lru":
+		keys := make(map[int]int64, len(list))
+		for _, idx := range list {
+			row := cache.RawValues[idx]
+			var k int64
+			if d := parseSmartTime(gs(row, INDEX_DATA_TIKTOK.LAST_ACTIVE_DATE)); !d.IsZero() { k = d.Unix() }
+			if t := lastRunTime(row); !t.IsZero() && t.Unix() > k { k = t.Unix() }
+			keys[idx] = k
+		}
+		sort.SliceStable(list, func(i, j int) bool { return keys[list[i]] < keys[list[j]] })
+	case "random":
+		rand.Shuffle(len(list), func(i, j int) { list[i], list[j] = list[j], list[i] })
+	}
+	return list
+}
+
+// markRotation: Ghi nhận dòng vừa cấp (Cho round_robin)
+func markRotation(sid, status string, idx int) {
+	rotationCursors.Lock()
+	rotationCursors.Last[sid+KEY_SEPARATOR+status] = idx
+	rotationCursors.Unlock()
+}
+
+// lastRunTime: Giờ chạy gần nhất ghi trong Note ("dd/MM/yyyy HH:mm:ss", VN_ZONE - Cùng múi với lúc ghi qua nowVN)
+func lastRunTime(row []interface{}) time.Time {
+	m := REGEX_NOTE_TIME.FindString(gs(row, INDEX_DATA_TIKTOK.NOTE))
+	if m == "" { return time.Time{} }
+	return parseSmartTime(m)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// =================================================================================================
+// 🛂 QUYỀN TOKEN (SCOPES) & CHE CỘT
+// =================================================================================================
+// - Quyền nằm trong bản ghi Token Firebase: "scopes": ["read:auth", "write:status"] (Mảng hoặc chuỗi phân cách dấu phẩy).
+//   Không có trường này = Token cũ (Tạo tay trước khi có Scopes) -> SCOPES.LEGACY (Toàn quyền như trước).
+//   Token cấp qua /tool/tokens luôn có "scopes" (Mặc định SCOPES.DEFAULT - Quyền tối thiểu), "admin" phải cấp rõ.
+// - Đọc: Ô không có quyền bị thay bằng SCOPES.MASK (/tool/search, AuthProfile / ActivityProfile / AiProfile).
+// - Ghi: Cập nhật cột không có quyền bị từ chối cả Request (/tool/updated, "updated" của /tool/login).
+// - Lọc theo cột không có quyền đọc bị từ chối (Tránh dò giá trị qua search_and / search_or).
+// - Sheet khác DataTiktok & API quản trị: Cần "admin".
+
+type ScopeSet map[string]bool
+
+// tokenScopes: Đọc quyền từ Token
+func tokenScopes(tokenData *TokenData) ScopeSet {
+	set := make(ScopeSet)
+	var raw []string
+	if tokenData != nil {
+		switch v := tokenData.Data["scopes"].(type) {
+		case []interface{}:
+			for _, s := range v { raw = append(raw, SafeString(s)) }
+		case string:
+			raw = strings.Split(v, ",")
+		case nil:
+			raw = SCOPES.LEGACY
+		} // Kiểu khác -> Không quyền nào
+	}
+	for _, s := range raw {
+		if s = CleanString(s); s != "" { set[s] = true }
+	}
+	return set
+}
+
+func (s ScopeSet) Has(scope string) bool { return s[SCOPES.ADMIN] || s[scope] }
+
+// colGroup: Nhóm quyền của cột DataTiktok ("" = Ngoài mọi nhóm -> Chỉ admin)
+func colGroup(col int) string {
+	for name, r := range SCOPES.COLUMN_GROUPS {
+		if col >= r[0] && col <= r[1] { return name }
+	}
+	return ""
+}
+
+func (s ScopeSet) CanRead(col int) bool  { return s[SCOPES.ADMIN] || s["read:"+colGroup(col)] }
+func (s ScopeSet) CanWrite(col int) bool { return s[SCOPES.ADMIN] || s["write:"+colGroup(col)] }
+
+// maskRow: Bản sao dòng, ô không có quyền đọc -> SCOPES.MASK
+func maskRow(row []interface{}, scopes ScopeSet) []interface{} {
+	out := make([]interface{}, len(row))
+	for c, v := range row {
+		if scopes.CanRead(c) { out[c] = v } else { out[c] = SCOPES.MASK }
+	}
+	return out
+}
+
+// checkWritableCols: Từ chối nếu có cột không được ghi
+func checkWritableCols(scopes ScopeSet, cols map[int]interface{}) error {
+	for c := range cols {
+		if !scopes.CanWrite(c) { return fmt.Errorf("Token không có quyền ghi cột %d", c) }
+	}
+	return nil
+}
+
+// checkFilterCols: Từ chối nếu bộ lọc dùng cột không được đọc
+func checkFilterCols(scopes ScopeSet, f FilterParams) error {
+	if !f.HasFilter { return nil }
+	for _, set := range []CriteriaSet{f.AndCriteria, f.OrCriteria} {
+		cols := []int{}
+		for c := range set.MatchCols { cols = append(cols, c) }
+		for c := range set.ContainsCols { cols = append(cols, c) }
+		for c := range set.MinCols { cols = append(cols, c) }
+		for c := range set.MaxCols { cols = append(cols, c) }
+		for c := range set.TimeCols { cols = append(cols, c) }
+		for _, c := range cols {
+			if !scopes.CanRead(c) { return fmt.Errorf("Token không có quyền lọc theo cột %d", c) }
+		}
+	}
+	return nil
+}
+
+// requireScope: Chặn Handler nếu Token thiếu quyền (Bọc bên trong AuthMiddleware)
+func requireScope(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenData, _ := r.Context().Value("tokenData").(*TokenData)
+		if !tokenScopes(tokenData).Has(scope) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": "Token không có quyền " + scope})
+			return
+		}
+		h(w, r)
+	}
+}
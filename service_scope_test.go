@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scopeRow: Dòng DataTiktok có Status, UserName & Password
+func scopeRow() []interface{} {
+	row := sensitiveRow("pass-1", "")
+	row[INDEX_DATA_TIKTOK.STATUS] = STATUS_WRITE.RUNNING
+	row[INDEX_DATA_TIKTOK.USER_NAME] = "user1"
+	return row
+}
+
+func tokenWithScopes(scopes interface{}) *TokenData {
+	data := map[string]interface{}{}
+	if scopes != nil { data["scopes"] = scopes }
+	return &TokenData{SpreadsheetID: "s", Data: data}
+}
+
+func TestTokenScopesLegacy(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes interface{}
+		admin  bool
+		status bool // Có write:status
+	}{
+		{"Token cũ (Không có scopes)", nil, true, true},
+		{"Token cấp qua /tool/tokens (Mặc định)", []interface{}{"read:status", "read:activity", "write:status"}, false, true},
+		{"chuỗi phân cách dấu phẩy", "read:auth, admin", true, true},
+		{"scopes sai kiểu", map[string]interface{}{"admin": true}, false, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tokenScopes(tokenWithScopes(tc.scopes))
+			if s.Has(SCOPES.ADMIN) != tc.admin { t.Fatalf("admin = %v, want %v", s.Has(SCOPES.ADMIN), tc.admin) }
+			if s.CanWrite(INDEX_DATA_TIKTOK.STATUS) != tc.status { t.Fatalf("write:status = %v, want %v", !tc.status, tc.status) }
+		})
+	}
+	if _, err := tokenScopeList(map[string]interface{}{"scopes": []interface{}{}}); err == nil { t.Fatal("scopes rỗng phải lỗi (Firebase bỏ mảng rỗng -> Thành Token cũ)") }
+}
+
+func TestSearchMasksAndRejects(t *testing.T) {
+	def := strings.Join(SCOPES.DEFAULT, ",")
+	pass := "col_" + strconv.Itoa(INDEX_DATA_TIKTOK.PASSWORD)
+	user := "col_" + strconv.Itoa(INDEX_DATA_TIKTOK.USER_NAME)
+	status := "col_" + strconv.Itoa(INDEX_DATA_TIKTOK.STATUS)
+	tests := []struct {
+		name   string
+		scopes interface{}
+		body   string
+		ok     bool
+		want   map[string]string // Cột -> Giá trị mong đợi
+	}{
+		{"quyền mặc định: che cột auth", def, `{}`, true, map[string]string{status: STATUS_WRITE.RUNNING, user: SCOPES.MASK, pass: SCOPES.MASK}},
+		{"read:auth: thấy cột auth", "read:status,read:auth", `{}`, true, map[string]string{status: STATUS_WRITE.RUNNING, user: "user1", pass: "pass-1"}},
+		{"Token cũ: thấy hết", nil, `{}`, true, map[string]string{user: "user1", pass: "pass-1"}},
+		{"lọc theo cột không được đọc", def, `{"search_and": {"match_` + pass + `": ["pass-1"]}}`, false, nil},
+		{"Sheet khác cần admin", def, `{"sheet": "Proxy"}`, false, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resetQueueForTest(t)
+			cachedDataSheet(t, "s", [][]interface{}{scopeRow()})
+			r := httptest.NewRequest("POST", "/tool/search", strings.NewReader(tc.body))
+			r = r.WithContext(context.WithValue(r.Context(), "tokenData", tokenWithScopes(tc.scopes)))
+			w := httptest.NewRecorder()
+			HandleSearchData(w, r)
+
+			var res struct {
+				Status string                            `json:"status"`
+				Data   map[string]map[string]interface{} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil { t.Fatalf("%v: %s", err, w.Body.String()) }
+			if (res.Status == "true") != tc.ok { t.Fatalf("status = %s, want ok = %v (%s)", res.Status, tc.ok, w.Body.String()) }
+			for col, want := range tc.want {
+				if got := res.Data["0"][col]; got != want { t.Errorf("%s = %v, want %q", col, got, want) }
+			}
+		})
+	}
+}
+
+func TestAuthProfileMasks(t *testing.T) {
+	resetQueueForTest(t)
+	row := scopeRow()
+	limited := MakeAuthProfile(profileRow("s", row, "", tokenScopes(tokenWithScopes("read:status"))))
+	if limited.Password != SCOPES.MASK || limited.UserName != SCOPES.MASK { t.Fatalf("cột auth phải bị che: %+v", limited) }
+	if limited.Status != STATUS_WRITE.RUNNING { t.Fatalf("status = %q", limited.Status) }
+	if full := MakeAuthProfile(profileRow("s", row, "", tokenScopes(tokenWithScopes(nil)))); full.Password != "pass-1" { t.Fatalf("Token cũ: password = %q", full.Password) }
+}
+
+func TestUpdateRejectsUnwritableCols(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes ScopeSet
+		col    int
+		ok     bool
+	}{
+		{"write:status ghi Note", tokenScopes(tokenWithScopes("write:status")), INDEX_DATA_TIKTOK.NOTE, true},
+		{"write:status ghi Password", tokenScopes(tokenWithScopes("write:status")), INDEX_DATA_TIKTOK.PASSWORD, false},
+		{"write:status ghi TODAY_POST_COUNT", tokenScopes(tokenWithScopes("write:status")), INDEX_DATA_TIKTOK.TODAY_POST_COUNT, false},
+		{"Token cũ ghi Password", tokenScopes(tokenWithScopes(nil)), INDEX_DATA_TIKTOK.PASSWORD, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resetQueueForTest(t)
+			cache := cachedDataSheet(t, "s", [][]interface{}{scopeRow()})
+			before := gs(cache.RawValues[0], tc.col)
+			body := map[string]interface{}{
+				"row_index": float64(RANGES.DATA_START_ROW),
+				"updated":   map[string]interface{}{"col_" + strconv.Itoa(tc.col): "new"},
+			}
+			_, err := xu_ly_update_logic("s", "", "updated", body, tc.scopes)
+			if (err == nil) != tc.ok { t.Fatalf("err = %v, want ok = %v", err, tc.ok) }
+			got := gs(cache.RawValues[0], tc.col)
+			if tc.ok && !strings.HasPrefix(got, "new") { t.Fatalf("ô = %q, want new", got) } // Note được thêm mốc thời gian
+			if !tc.ok && got != before { t.Fatalf("bị từ chối nhưng ô đã đổi: %q", got) }
+		})
+	}
+}
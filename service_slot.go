@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// =================================================================================================
+// 📱 NHIỀU NICK TRÊN 1 THIẾT BỊ (DEVICE SLOT)
+// =================================================================================================
+// - Máy chạy nhiều bản TikTok clone: Mỗi bản = 1 Slot, mỗi Slot giữ riêng 1 nick "Đang chạy".
+// - Slot được lưu ngay trong cột DeviceId: Slot 1 = "deviceId" (Giữ nguyên dữ liệu cũ),
+//   Slot N (N >= 2) = "deviceId#N" (DEVICE_SLOTS.SEPARATOR).
+// - AssignedMap: DeviceId gốc -> Mọi dòng của thiết bị (Mọi Slot).
+// - Dọn dẹp nick cũ (getCleanupIndices) và nick "Đang chạy" của mình chỉ xét ĐÚNG Slot.
+//   Nick "Đang chờ"/"Đăng nhập" của thiết bị thì Slot nào cũng lấy được.
+// - Số Slot tối đa: Trường "device_slots" trong Token Firebase, không có -> DEVICE_SLOTS.DEFAULT_MAX.
+
+// deviceKey: Giá trị ghi vào cột DeviceId cho (Device, Slot)
+func deviceKey(deviceId, slot string) string {
+	if deviceId == "" || slot == "" || slot == "1" { return deviceId }
+	return deviceId + DEVICE_SLOTS.SEPARATOR + slot
+}
+
+// baseDevice: Bỏ hậu tố Slot khỏi giá trị cột DeviceId
+func baseDevice(cell string) string {
+	if i := strings.LastIndex(cell, DEVICE_SLOTS.SEPARATOR); i > 0 {
+		if _, err := strconv.Atoi(cell[i+len(DEVICE_SLOTS.SEPARATOR):]); err == nil { return cell[:i] }
+	}
+	return cell
+}
+
+// sameDevice: 2 giá trị DeviceId thuộc cùng 1 thiết bị (Bỏ qua Slot)
+func sameDevice(a, b string) bool {
+	return a != "" && baseDevice(a) == baseDevice(b)
+}
+
+// ownsSlot: Ô DeviceId thuộc đúng Slot của Request.
+// explicit = Body có "slot" (Kể cả 1) hoặc devKey mang hậu tố Slot -> So khớp tuyệt đối; Tool cũ không gửi Slot -> Mọi Slot của thiết bị.
+func ownsSlot(cell, devKey string, explicit bool) bool {
+	if explicit || devKey != baseDevice(devKey) { return cell != "" && cell == devKey }
+	return sameDevice(cell, devKey)
+}
+
+// resolveSlot: Đọc & kiểm tra "slot" trong Body. Trả về "" nếu là Slot mặc định.
+func resolveSlot(tokenData *TokenData, body map[string]interface{}) (string, error) {
+	raw := CleanString(body["slot"])
+	if raw == "" { return "", nil }
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 { return "", fmt.Errorf("Slot không hợp lệ") }
+
+	max := DEVICE_SLOTS.DEFAULT_MAX
+	if tokenData != nil {
+		if v, ok := toFloat(tokenData.Data["device_slots"]); ok && v >= 1 { max = int(v) }
+	}
+	if n > max { return "", fmt.Errorf("Slot vượt quá số Slot cho phép (%d)", max) }
+	if n == 1 { return "", nil }
+	return raw, nil
+}
+
+// reindexDevice: Cập nhật AssignedMap / UnassignedList khi cột DeviceId đổi. Yêu cầu giữ SheetMutex (Write).
+func reindexDevice(cache *SheetCacheData, idx int, oldDev, newDev string) {
+	if oldDev == newDev { return }
+	if oldDev != "" {
+		key := baseDevice(oldDev)
+		rows := cache.AssignedMap[key]
+		removeFromIntList(&rows, idx)
+		if len(rows) == 0 { delete(cache.AssignedMap, key) } else { cache.AssignedMap[key] = rows }
+	} else {
+		removeFromIntList(&cache.UnassignedList, idx)
+	}
+	if newDev != "" {
+		key := baseDevice(newDev)
+		cache.AssignedMap[key] = append(cache.AssignedMap[key], idx)
+	} else {
+		cache.UnassignedList = append(cache.UnassignedList, idx)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestOwnsSlot(t *testing.T) {
+	tests := []struct {
+		name string
+		cell string
+		slot string // "slot" trong Body ("" = Không gửi)
+		want bool
+	}{
+		{"Tool cũ - Slot 1", "dev", "", true},
+		{"Tool cũ - Slot 2", "dev#2", "", true},
+		{"slot 1 - Slot 1", "dev", "1", true},
+		{"slot 1 - Slot 2", "dev#2", "1", false},
+		{"slot 2 - Slot 2", "dev#2", "2", true},
+		{"slot 2 - Slot 1", "dev", "2", false},
+		{"slot 2 - Slot 3", "dev#3", "2", false},
+		{"thiết bị khác", "other", "", false},
+		{"ô trống", "", "1", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			slot, err := resolveSlot(&TokenData{Data: map[string]interface{}{"device_slots": 3.0}}, map[string]interface{}{"slot": tc.slot})
+			if err != nil { t.Fatal(err) }
+			if got := ownsSlot(tc.cell, deviceKey("dev", slot), tc.slot != ""); got != tc.want { t.Fatalf("ownsSlot = %v, want %v", got, tc.want) }
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// =================================================================================================
+// 🗄️ SQL STORE (SQLITE / POSTGRES) - THAY THẾ GOOGLE SHEETS
+// =================================================================================================
+// - Giữ nguyên bố cục 61 cột của INDEX_DATA_TIKTOK: mỗi bảng có row_idx + c0..c60 (TEXT).
+//   Ghi rộng hơn (Sheet Log / Sheet tự tạo) -> Tự ALTER TABLE thêm cột, tối đa SQL_STORE.MAX_COLS.
+// - row_idx chính là index trong Cache (0 = dòng DATA_START_ROW) -> row_index API không đổi.
+// - Tenant: SQLite -> 1 file/spreadsheetId, Postgres -> 1 Schema/spreadsheetId.
+
+// isRetryableSQLError: Lỗi SQL tạm thời (Mất kết nối, Deadlock, Server quá tải, SQLite đang khóa file)
+func isRetryableSQLError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) { return true }
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "40", "53", "57": // Connection / Rollback / Resources / Operator intervention
+			return true
+		}
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "SQLITE_BUSY")
+}
+
+type SQLSheetStore struct {
+	dialect string // "sqlite" | "postgres"
+	dsn     string // Postgres: DSN kết nối | SQLite: Thư mục chứa file DB
+
+	mu     sync.Mutex
+	dbs    map[string]*sql.DB // SQLite: Key = sid | Postgres: Key = "" (dùng chung 1 pool)
+	tables map[string]int     // Bảng đã CREATE -> Số cột dữ liệu hiện có (Key: sid__table)
+}
+
+func NewSQLSheetStore(dialect, dsn string) (*SQLSheetStore, error) {
+	s := &SQLSheetStore{
+		dialect: dialect,
+		dsn:     dsn,
+		dbs:     make(map[string]*sql.DB),
+		tables:  make(map[string]int),
+	}
+	if dialect == "postgres" {
+		if dsn == "" { return nil, fmt.Errorf("Thiếu SQL_DSN cho Postgres") }
+		db, err := sql.Open("postgres", dsn)
+		if err != nil { return nil, err }
+		if err := db.Ping(); err != nil { return nil, err }
+		s.dbs[""] = db
+		return s, nil
+	}
+	if dsn == "" { s.dsn = SQL_STORE.SQLITE_DIR }
+	if err := os.MkdirAll(s.dsn, 0o755); err != nil { return nil, err }
+	return s, nil
+}
+
+func (s *SQLSheetStore) LoadRows(sid, sheetName string) ([][]interface{}, error) {
+	db, table, err := s.prepare(sid, sheetName)
+	if err != nil { return nil, err }
+	width := s.width(sid, table)
+
+	query := fmt.Sprintf("SELECT row_idx, %s FROM %s WHERE row_idx < %s ORDER BY row_idx",
+		strings.Join(sqlColumnNames(0, width), ", "), table, s.ph(1))
+	rs, err := db.Query(query, SQL_STORE.MAX_ROW)
+	if err != nil { return nil, err }
+	defer rs.Close()
+
+	rows := make([][]interface{}, 0)
+	cells := make([]sql.NullString, width)
+	dest := make([]interface{}, width+1)
+	var rowIdx int
+	dest[0] = &rowIdx
+	for i := range cells { dest[i+1] = &cells[i] }
+
+	for rs.Next() {
+		if err := rs.Scan(dest...); err != nil { return nil, err }
+		// Lấp các dòng trống ở giữa để giữ đúng row_index
+		for len(rows) < rowIdx { rows = append(rows, []interface{}{}) }
+
+		// Giống Google: Bỏ các ô trống ở cuối dòng
+		last := -1
+		for i, c := range cells { if c.Valid && c.String != "" { last = i } }
+		row := make([]interface{}, last+1)
+		for i := 0; i <= last; i++ { row[i] = cells[i].String }
+		rows = append(rows, row)
+	}
+	return rows, rs.Err()
+}
+
+func (s *SQLSheetStore) WriteBlocks(sid string, blocks []CellBlock) error {
+	if len(blocks) == 0 { return nil }
+	// Chuẩn bị bảng & đủ cột TRƯỚC khi mở Transaction (SQLite chỉ có 1 kết nối)
+	var db *sql.DB
+	tables := make(map[string]string)
+	need := make(map[string]int)
+	for _, b := range blocks {
+		if b.Row < 0 || b.Col < 0 { return &PermanentStoreError{fmt.Sprintf("Range không hợp lệ: %s!R%dC%d", b.Sheet, b.Row, b.Col)} }
+		for _, vals := range b.Values {
+			if w := b.Col + len(vals); w > need[b.Sheet] { need[b.Sheet] = w }
+		}
+		if _, ok := tables[b.Sheet]; ok { continue }
+		d, table, err := s.prepare(sid, b.Sheet)
+		if err != nil { return err }
+		db, tables[b.Sheet] = d, table
+	}
+	for sheet, w := range need {
+		if err := s.ensureWidth(db, sid, tables[sheet], w); err != nil { return err }
+	}
+
+	tx, err := db.Begin()
+	if err != nil { return err }
+	for _, b := range blocks {
+		table := tables[b.Sheet]
+		for r, vals := range b.Values {
+			if err := s.upsertRow(tx, table, b.Row+r, b.Col, vals); err != nil { tx.Rollback(); return err }
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLSheetStore) AppendRows(sid, sheetName string, rows [][]interface{}) error {
+	if len(rows) == 0 { return nil }
+	db, table, err := s.prepare(sid, sheetName)
+	if err != nil { return err }
+	need := 0
+	for _, row := range rows {
+		if len(row) > need { need = len(row) }
+	}
+	if err := s.ensureWidth(db, sid, table, need); err != nil { return err }
+
+	// Khóa để 2 lần Append song song không lấy trùng row_idx
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil { return err }
+	next := 0
+	if err := tx.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(row_idx), -1) + 1 FROM %s", table)).Scan(&next); err != nil {
+		tx.Rollback(); return err
+	}
+	for i, row := range rows {
+		if err := s.upsertRow(tx, table, next+i, 0, row); err != nil { tx.Rollback(); return err }
+	}
+	return tx.Commit()
+}
+
+// --- HÀM NỘI BỘ ---
+
+// upsertRow: Ghi các ô [col, col+len) của 1 dòng, giữ nguyên các cột khác (Bảng đã đủ cột qua ensureWidth)
+func (s *SQLSheetStore) upsertRow(tx *sql.Tx, table string, rowIdx, col int, vals []interface{}) error {
+	n := len(vals)
+	cols := sqlColumnNames(col, n)
+
+	args := make([]interface{}, 0, n+1)
+	args = append(args, rowIdx)
+	holders := []string{s.ph(1)}
+	sets := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		args = append(args, sqlCellValue(vals[i]))
+		holders = append(holders, s.ph(i+2))
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", cols[i], cols[i]))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (row_idx", table)
+	if n > 0 { query += ", " + strings.Join(cols, ", ") }
+	query += fmt.Sprintf(") VALUES (%s) ON CONFLICT (row_idx) DO ", strings.Join(holders, ", "))
+	if n > 0 { query += "UPDATE SET " + strings.Join(sets, ", ") } else { query += "NOTHING" }
+
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+// prepare: Lấy kết nối của Tenant và đảm bảo bảng đã tồn tại
+func (s *SQLSheetStore) prepare(sid, sheetName string) (*sql.DB, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := ""
+	if s.dialect != "postgres" { key = sid }
+	db, ok := s.dbs[key]
+	if !ok {
+		path := filepath.Join(s.dsn, SafeIdent(sid)+".db")
+		var err error
+		db, err = sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+		if err != nil { return nil, "", err }
+		db.SetMaxOpenConns(1) // SQLite chỉ cho 1 Writer
+		s.dbs[key] = db
+	}
+
+	table := sqlTableName(sheetName)
+	if s.dialect == "postgres" {
+		table = fmt.Sprintf(`"%s"."%s"`, SQL_STORE.SCHEMA_PREFIX+SafeIdent(sid), table)
+	}
+
+	cacheKey := sid + KEY_SEPARATOR + table
+	if s.tables[cacheKey] == 0 {
+		if s.dialect == "postgres" {
+			schema := SQL_STORE.SCHEMA_PREFIX + SafeIdent(sid)
+			if _, err := db.Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s"`, schema)); err != nil { return nil, "", err }
+		}
+		colDefs := make([]string, 0, sqlColCount())
+		for _, c := range sqlColumnNames(0, sqlColCount()) { colDefs = append(colDefs, c+" TEXT") }
+		ddl := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (row_idx INTEGER PRIMARY KEY, %s)", table, strings.Join(colDefs, ", "))
+		if _, err := db.Exec(ddl); err != nil { return nil, "", err }
+
+		// Bảng có sẵn có thể đã được nới rộng trước đó
+		rs, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table))
+		if err != nil { return nil, "", err }
+		names, err := rs.Columns()
+		rs.Close()
+		if err != nil { return nil, "", err }
+		s.tables[cacheKey] = len(names) - 1 // Trừ row_idx
+	}
+	return db, table, nil
+}
+
+// width: Số cột dữ liệu hiện có của bảng (Sau prepare)
+func (s *SQLSheetStore) width(sid, table string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tables[sid+KEY_SEPARATOR+table]
+}
+
+// ensureWidth: Thêm cột c<width>..c<need-1> nếu dòng ghi rộng hơn bảng. Gọi NGOÀI Transaction.
+func (s *SQLSheetStore) ensureWidth(db *sql.DB, sid, table string, need int) error {
+	if need > SQL_STORE.MAX_COLS {
+		return &PermanentStoreError{fmt.Sprintf("Vượt quá %d cột: %s (%d cột)", SQL_STORE.MAX_COLS, table, need)}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sid + KEY_SEPARATOR + table
+	for c := s.tables[key]; c < need; c++ {
+		ddl := fmt.Sprintf("ALTER TABLE %s ADD COLUMN c%d TEXT", table, c)
+		if s.dialect == "postgres" { ddl = fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS c%d TEXT", table, c) }
+		if _, err := db.Exec(ddl); err != nil { return err }
+		s.tables[key] = c + 1
+	}
+	return nil
+}
+
+func (s *SQLSheetStore) ph(i int) string {
+	if s.dialect == "postgres" { return "$" + strconv.Itoa(i) }
+	return "?"
+}
+
+// sqlColCount: Số cột dữ liệu khi tạo bảng (Cột A -> BI = 61 cột)
+func sqlColCount() int { return INDEX_DATA_TIKTOK.COUNTRY + 1 }
+
+func sqlColumnNames(from, n int) []string {
+	cols := make([]string, n)
+	for i := range cols { cols[i] = "c" + strconv.Itoa(from+i) }
+	return cols
+}
+
+func sqlTableName(sheetName string) string {
+	if t, ok := SQL_TABLES[sheetName]; ok { return t }
+	return "sheet_" + SafeIdent(sheetName)
+}
+
+func sqlCellValue(v interface{}) string {
+	if v == nil { return "" }
+	if f, ok := v.(float64); ok { return strconv.FormatFloat(f, 'f', -1, 64) }
+	return fmt.Sprintf("%v", v)
+}
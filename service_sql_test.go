@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newSQLiteStoreForTest(t *testing.T) *SQLSheetStore {
+	t.Helper()
+	s, err := NewSQLSheetStore("sqlite", t.TempDir())
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() {
+		for _, db := range s.dbs { db.Close() }
+	})
+	return s
+}
+
+func TestSQLStoreRoundTrip(t *testing.T) {
+	s := newSQLiteStoreForTest(t)
+	sheet := SHEET_NAMES.DATA_TIKTOK
+
+	if err := s.AppendRows("s", sheet, [][]interface{}{{"a", "b"}, {"c", 1.5}}); err != nil { t.Fatal(err) }
+	if err := s.WriteBlocks("s", []CellBlock{{Sheet: sheet, Row: 0, Col: 1, Values: [][]interface{}{{"B", "x"}}}}); err != nil { t.Fatal(err) }
+	// Ghi cách dòng -> Dòng giữa trống, row_index giữ nguyên
+	if err := s.WriteBlocks("s", []CellBlock{{Sheet: sheet, Row: 3, Col: 0, Values: [][]interface{}{{"d"}}}}); err != nil { t.Fatal(err) }
+
+	rows, err := s.LoadRows("s", sheet)
+	if err != nil { t.Fatal(err) }
+	want := [][]interface{}{{"a", "B", "x"}, {"c", "1.5"}, {}, {"d"}}
+	if fmt.Sprint(rows) != fmt.Sprint(want) { t.Fatalf("rows = %v, want %v", rows, want) }
+
+	// Append sau dòng cuối hiện có
+	if err := s.AppendRows("s", sheet, [][]interface{}{{"e"}}); err != nil { t.Fatal(err) }
+	rows, _ = s.LoadRows("s", sheet)
+	if len(rows) != 5 || fmt.Sprint(rows[4]) != "[e]" { t.Fatalf("rows = %v", rows) }
+
+	if err := s.WriteBlocks("s", []CellBlock{{Sheet: sheet, Row: -1, Col: 0, Values: [][]interface{}{{"x"}}}}); err == nil || isRetryableStoreError(err) {
+		t.Fatalf("Range sai phải là lỗi vĩnh viễn: %v", err)
+	}
+}
+
+func TestSQLStoreTenantIsolation(t *testing.T) {
+	s := newSQLiteStoreForTest(t)
+	sheet := SHEET_NAMES.DATA_TIKTOK
+	if err := s.AppendRows("tenant-a", sheet, [][]interface{}{{"a1"}}); err != nil { t.Fatal(err) }
+	if err := s.AppendRows("tenant-b", sheet, [][]interface{}{{"b1"}, {"b2"}}); err != nil { t.Fatal(err) }
+
+	a, _ := s.LoadRows("tenant-a", sheet)
+	b, _ := s.LoadRows("tenant-b", sheet)
+	if fmt.Sprint(a) != "[[a1]]" || fmt.Sprint(b) != "[[b1] [b2]]" { t.Fatalf("a = %v, b = %v", a, b) }
+	if c, _ := s.LoadRows("tenant-c", sheet); len(c) != 0 { t.Fatalf("Tenant mới phải trống: %v", c) }
+}
+
+func TestSQLStoreWideRows(t *testing.T) {
+	tests := []struct {
+		name  string
+		width int
+		ok    bool
+	}{
+		{"đúng 61 cột", sqlColCount(), true},
+		{"62 cột", sqlColCount() + 1, true},
+		{"100 cột", 100, true},
+		{"vượt MAX_COLS", SQL_STORE.MAX_COLS + 1, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newSQLiteStoreForTest(t)
+			row := make([]interface{}, tc.width)
+			for i := range row { row[i] = fmt.Sprintf("v%d", i) }
+
+			err := s.AppendRows("s", "Log", [][]interface{}{row})
+			if !tc.ok {
+				if err == nil || isRetryableStoreError(err) { t.Fatalf("phải là lỗi vĩnh viễn: %v", err) }
+				return
+			}
+			if err != nil { t.Fatal(err) }
+			// Cập nhật ô cuối qua WriteBlocks (Bảng đã nới rộng)
+			if err := s.WriteBlocks("s", []CellBlock{{Sheet: "Log", Row: 0, Col: tc.width - 1, Values: [][]interface{}{{"last"}}}}); err != nil { t.Fatal(err) }
+
+			// Store mới (Giả lập Restart) đọc được đủ cột của bảng đã nới
+			s2 := &SQLSheetStore{dialect: "sqlite", dsn: s.dsn, dbs: s.dbs, tables: make(map[string]int)}
+			rows, err := s2.LoadRows("s", "Log")
+			if err != nil { t.Fatal(err) }
+			if len(rows) != 1 || len(rows[0]) != tc.width { t.Fatalf("độ rộng = %d, want %d", len(rows[0]), tc.width) }
+			if rows[0][0] != "v0" || rows[0][tc.width-1] != "last" { t.Fatalf("row = %v ... %v", rows[0][0], rows[0][tc.width-1]) }
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// =================================================================================================
+// 📦 LỚP LƯU TRỮ (STORAGE BACKEND)
+// =================================================================================================
+// Mọi thao tác đọc/ghi Sheet đều đi qua interface SheetStore.
+// LayDuLieu, FlushQueue và các Handler không gọi thẳng Google API nữa,
+// nhờ đó Server có thể chạy (và test) hoàn toàn trong RAM khi thiếu Credential.
+
+// CellBlock: 1 khối ô liên tục cần ghi xuống Sheet.
+// Row tính từ 0 và tương đối với RANGES.DATA_START_ROW (giống index trong Cache).
+// Col tính từ 0 (Cột A = 0).
+type CellBlock struct {
+	Sheet  string
+	Row    int
+	Col    int
+	Values [][]interface{}
+}
+
+// SheetStore: Hợp đồng chung cho mọi Backend lưu trữ (Google Sheets, RAM...)
+type SheetStore interface {
+	// LoadRows: Đọc toàn bộ dòng dữ liệu (từ DATA_START_ROW đến DATA_MAX_ROW)
+	LoadRows(sid, sheetName string) ([][]interface{}, error)
+	// WriteBlocks: Ghi đè các khối ô đã chỉ định
+	WriteBlocks(sid string, blocks []CellBlock) error
+	// AppendRows: Thêm dòng mới vào cuối Sheet
+	AppendRows(sid, sheetName string, rows [][]interface{}) error
+}
+
+// VersionProber: (Tùy chọn) Store hỏi được "Sheet đã đổi chưa" rẻ hơn LoadRows.
+// Watcher chỉ đọc cả Sheet khi phiên bản đổi. Store không hỗ trợ -> Luôn đọc đầy đủ.
+type VersionProber interface {
+	// SheetVersion: Chuỗi đổi mỗi khi dữ liệu đổi. "" = Không xác định (Watcher đọc đầy đủ)
+	SheetVersion(sid, sheetName string) (string, error)
+}
+
+// PermanentStoreError: Lỗi ghi KHÔNG nên thử lại (Range sai, Sheet không tồn tại...).
+// Queue sẽ chuyển thẳng Batch vào Dead-letter thay vì Backoff.
+type PermanentStoreError struct {
+	Msg string
+}
+
+func (e *PermanentStoreError) Error() string { return e.Msg }
+
+// sheetStore: Backend đang được dùng (Khởi tạo 1 lần trong main.go)
+var sheetStore SheetStore
+
+// InitSheetStore: Chọn Backend theo biến môi trường STORE_BACKEND.
+// - "memory": Luôn chạy RAM (Dùng cho dev/test)
+// - "sqlite" / "postgres": Dùng SQL Store (Env SQLITE_DIR hoặc SQL_DSN)
+// - Mặc định: Google Sheets, tự lùi về RAM nếu thiếu/lỗi Credential (Limited mode)
+func InitSheetStore(credJSON []byte) {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORE_BACKEND")))
+	if backend == "memory" {
+		sheetStore = NewMemorySheetStore()
+		fmt.Println("✅ Memory Store initialized (STORE_BACKEND=memory).")
+		return
+	}
+	if backend == "sqlite" || backend == "postgres" {
+		dsn := os.Getenv("SQL_DSN")
+		if backend == "sqlite" { dsn = os.Getenv("SQLITE_DIR") }
+		store, err := NewSQLSheetStore(backend, dsn)
+		// Đã chọn SQL mà không mở được -> Dừng hẳn (Memory Store sẽ mất hết dữ liệu khi khởi động lại)
+		if err != nil { log.Fatalf("❌ [STORE] Không kết nối được %s: %v", backend, err) }
+		sheetStore = store
+		fmt.Printf("✅ SQL Store initialized (%s).\n", backend)
+		return
+	}
+
+	if err := InitGoogleService(credJSON); err != nil {
+		log.Printf("⚠️ [STORE] Google Sheets không khả dụng (%v) -> Dùng Memory Store.", err)
+		sheetStore = NewMemorySheetStore()
+		return
+	}
+	sheetStore = &GoogleSheetStore{srv: sheetsService, drive: driveService}
+}
+
+// =================================================================================================
+// 🧠 MEMORY STORE (Chạy không cần Google)
+// =================================================================================================
+
+type MemorySheetStore struct {
+	mu       sync.RWMutex
+	sheets   map[string][][]interface{} // Key: SheetID__SheetName -> Rows
+	versions map[string]int64           // Key: SheetID__SheetName -> Số lần ghi (VersionProber)
+}
+
+func NewMemorySheetStore() *MemorySheetStore {
+	return &MemorySheetStore{sheets: make(map[string][][]interface{}), versions: make(map[string]int64)}
+}
+
+func (m *MemorySheetStore) SheetVersion(sid, sheetName string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return strconv.FormatInt(m.versions[sid+KEY_SEPARATOR+sheetName], 10), nil
+}
+
+func (m *MemorySheetStore) LoadRows(sid, sheetName string) ([][]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rows := m.sheets[sid+KEY_SEPARATOR+sheetName]
+	limit := RANGES.DATA_MAX_ROW - RANGES.DATA_START_ROW + 1
+	if len(rows) > limit { rows = rows[:limit] }
+
+	// Trả về bản sao để Cache sửa thoải mái mà không đụng vào Store
+	out := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		out[i] = make([]interface{}, len(row))
+		copy(out[i], row)
+	}
+	return out, nil
+}
+
+func (m *MemorySheetStore) WriteBlocks(sid string, blocks []CellBlock) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, b := range blocks {
+		if b.Row < 0 || b.Col < 0 { return &PermanentStoreError{fmt.Sprintf("Range không hợp lệ: %s!R%dC%d", b.Sheet, b.Row, b.Col)} }
+		key := sid + KEY_SEPARATOR + b.Sheet
+		rows := m.sheets[key]
+		for r, vals := range b.Values {
+			idx := b.Row + r
+			for len(rows) <= idx { rows = append(rows, []interface{}{}) }
+			row := rows[idx]
+			for len(row) < b.Col+len(vals) { row = append(row, "") }
+			copy(row[b.Col:], vals)
+			rows[idx] = row
+		}
+		m.sheets[key] = rows
+		m.versions[key]++
+	}
+	return nil
+}
+
+func (m *MemorySheetStore) AppendRows(sid, sheetName string, rows [][]interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := sid + KEY_SEPARATOR + sheetName
+	for _, row := range rows {
+		cp := make([]interface{}, len(row))
+		copy(cp, row)
+		m.sheets[key] = append(m.sheets[key], cp)
+	}
+	m.versions[key]++
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+)
+
+// =================================================================================================
+// 🔄 ĐỒNG BỘ CHỈNH SỬA TAY (SHEET ⇄ RAM CACHE)
+// =================================================================================================
+// Operator hay sửa DataTiktok bằng tay trong lúc Cache còn hạn (5 phút).
+// - Watcher: Mỗi CACHE.CHANGE_CHECK_MS hỏi phiên bản Store (VersionProber, vd Drive modifiedTime: 1 request nhỏ).
+//   Phiên bản đổi (hoặc quá CACHE.CHANGE_FULL_MS) -> Đọc lại Sheet, so Fingerprint TỪNG DÒNG (Mọi cột) với BaseValues.
+// - Có khác biệt (hoặc Cache hết hạn) -> HỢP NHẤT 3 CHIỀU ngay trên bản vừa đọc:
+//     Base (Store lúc trước) / Cache (RAM + Queue đang chờ) / Fresh (Store hiện tại)
+// - Ô bị sửa ở cả 2 phía -> Xung đột: Giải quyết theo CACHE.CONFLICT_POLICY và ghi vào ErrorLogger.
+// - Flush cập nhật Base trong lúc đang đọc Fresh (BaseGen đổi) -> Bỏ lượt này (Fresh đã cũ, tránh trả lại giá trị vừa ghi đè).
+// - Operator thắng nhưng ô đã nằm trong lượt Flush đang chạy -> Xếp hàng ghi lại bản Operator sau lượt đó.
+
+// RunSheetWatcher: Chạy nền suốt vòng đời Server (main.go)
+func RunSheetWatcher() {
+	ticker := time.NewTicker(time.Duration(CACHE.CHANGE_CHECK_MS) * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		suffix := KEY_SEPARATOR + SHEET_NAMES.DATA_TIKTOK
+		var sids []string
+		STATE.SheetMutex.RLock()
+		for k := range STATE.SheetCache {
+			if strings.HasSuffix(k, suffix) { sids = append(sids, strings.TrimSuffix(k, suffix)) }
+		}
+		STATE.SheetMutex.RUnlock()
+
+		for _, sid := range sids {
+			if err := checkSheetChanged(sid, SHEET_NAMES.DATA_TIKTOK); err != nil {
+				log.Printf("⚠️ [SYNC] %s: %v", sid, err)
+			}
+		}
+	}
+}
+
+// checkSheetChanged: Hỏi phiên bản, đổi -> So Fingerprint từng dòng với BaseValues, khác -> Hợp nhất
+func checkSheetChanged(sid, sheetName string) error {
+	STATE.SheetMutex.RLock()
+	cache, ok := STATE.SheetCache[sid+KEY_SEPARATOR+sheetName]
+	var gen, checkedAt int64
+	var lastVersion string
+	if ok { gen, lastVersion, checkedAt = cache.BaseGen, cache.StoreVersion, cache.FullCheckAt }
+	STATE.SheetMutex.RUnlock()
+	if !ok { return nil }
+
+	// Hỏi phiên bản TRƯỚC khi đọc: Thay đổi xảy ra sau mốc này sẽ làm lượt sau thấy phiên bản khác
+	version := ""
+	if p, ok := sheetStore.(VersionProber); ok {
+		v, err := p.SheetVersion(sid, sheetName)
+		if err != nil { log.Printf("⚠️ [SYNC] %s: Hỏi phiên bản lỗi (%v) -> Đọc cả Sheet", sid, err) }
+		version = v
+	}
+	now := time.Now().UnixMilli()
+	if version != "" && version == lastVersion && now-checkedAt < CACHE.CHANGE_FULL_MS { return nil }
+
+	fresh, err := sheetStore.LoadRows(sid, sheetName)
+	if err != nil { return err }
+
+	STATE.SheetMutex.RLock()
+	changed := len(fresh) != len(cache.BaseValues)
+	for i := 0; i < len(fresh) && !changed; i++ {
+		changed = rowFingerprint(fresh[i]) != rowFingerprint(cache.BaseValues[i])
+	}
+	STATE.SheetMutex.RUnlock()
+	if changed && !reconcileSheet(sid, sheetName, cache, fresh, gen) { return nil } // Bỏ lượt -> Chưa ghi nhận phiên bản
+
+	STATE.SheetMutex.Lock()
+	cache.StoreVersion, cache.FullCheckAt = version, now
+	STATE.SheetMutex.Unlock()
+	return nil
+}
+
+// rowFingerprint: Hash cả dòng (Bỏ ô trống cuối dòng: Store thường cắt đi)
+func rowFingerprint(row []interface{}) uint64 {
+	n := len(row)
+	for n > 0 && SafeString(row[n-1]) == "" { n-- }
+	h := fnv.New64a()
+	for c := 0; c < n; c++ {
+		h.Write([]byte(SafeString(row[c])))
+		h.Write([]byte{0x1f})
+	}
+	return h.Sum64()
+}
+
+// reconcileSheet: Hợp nhất 3 chiều dữ liệu mới từ Store vào Cache hiện có (Giữ nguyên con trỏ Cache)
+// gen: BaseGen lúc bắt đầu đọc fresh. Đã đổi -> Bỏ qua (Lượt sau đọc lại), trả về false.
+func reconcileSheet(sid, sheetName string, cache *SheetCacheData, fresh [][]interface{}, gen int64) bool {
+	type droppedCell struct {
+		row, col int
+		val      interface{} // Bản Operator (Thắng xung đột)
+	}
+	var conflicts [][]interface{}
+	var dropped []droppedCell
+	outside := 0
+	now := nowVN().Format("02/01/2006 15:04:05")
+
+	STATE.SheetMutex.Lock()
+	if cache.BaseGen != gen {
+		STATE.SheetMutex.Unlock()
+		log.Printf("🔁 [SYNC] %s/%s: Flush vừa ghi trong lúc đọc -> Hợp nhất lại ở lượt sau", sid, sheetName)
+		return false
+	}
+	// Không bao giờ thu ngắn Cache (Handler đang giữ index) -> Dòng bị xóa coi như dòng trống
+	n := len(cache.RawValues)
+	if len(fresh) > n { n = len(fresh) }
+	merged := make([][]interface{}, n)
+	store := make([][]interface{}, n)
+
+	for i := 0; i < n; i++ {
+		width := 0
+		for _, rows := range [][][]interface{}{cache.RawValues, cache.BaseValues, fresh} {
+			if i < len(rows) && len(rows[i]) > width { width = len(rows[i]) }
+		}
+		row := make([]interface{}, width)
+		storeRow := make([]interface{}, width)
+		for c := 0; c < width; c++ {
+			base, ours, theirs := cellAt(cache.BaseValues, i, c), cellAt(cache.RawValues, i, c), cellAt(fresh, i, c)
+			storeRow[c] = theirs
+			b, o, t := SafeString(base), SafeString(ours), SafeString(theirs)
+			switch {
+			case t == b: // Store không đổi -> Giữ bản RAM (Có thể đang chờ ghi)
+				row[c] = ours
+			case o == b: // Chỉ Operator sửa -> Nhận bản mới
+				row[c] = theirs
+				outside++
+			case o == t: // Hai bên sửa giống nhau
+				row[c] = theirs
+			default: // Xung đột thật sự
+				resolution := "Giữ bản Sheet"
+				row[c] = theirs
+				if CACHE.CONFLICT_POLICY == "queue" {
+					resolution = "Giữ bản Tool"
+					row[c] = ours
+				} else {
+					dropped = append(dropped, droppedCell{i, c, theirs})
+				}
+				if sheetName == SHEET_NAMES.DATA_TIKTOK && isSensitiveCol(c) { o, t = "***", "***" } // Không lộ cột nhạy cảm ra ErrorLogger
+				conflicts = append(conflicts, []interface{}{
+					now, "SYNC_CONFLICT", sheetName, RANGES.DATA_START_ROW + i, ColumnLetter(c), o, t, resolution,
+				})
+			}
+		}
+		merged[i] = row
+		store[i] = storeRow
+	}
+
+	rebuilt := buildSheetCache(sheetName, merged)
+	cache.RawValues = rebuilt.RawValues
+	cache.CleanValues = rebuilt.CleanValues
+	cache.AssignedMap = rebuilt.AssignedMap
+	cache.UnassignedList = rebuilt.UnassignedList
+	cache.StatusMap = rebuilt.StatusMap
+	cache.BaseValues = store
+	cache.SizeBytes = estimateCacheBytes(cache)
+	cache.Timestamp = time.Now().UnixMilli()
+
+	// Operator thắng -> Bỏ các ô đang chờ ghi tương ứng (Tránh đè lại chỉnh sửa tay).
+	// Ô đã nằm trong lượt Flush đang chạy (Không rút lại được) -> Xếp hàng ghi lại bản Operator ngay sau lượt đó.
+	// Làm trong SheetMutex: Flush chưa thể cập nhật Base, Handler chưa thể xếp giá trị mới hơn vào trước.
+	var restore journalTicket
+	if len(dropped) > 0 {
+		rewrite := make(map[int]RowCells)
+		STATE.QueueMutex.Lock()
+		if q, ok := STATE.WriteQueue[sid]; ok {
+			for _, d := range dropped {
+				if cells, ok := q.Updates[sheetName][d.row]; ok {
+					delete(cells, d.col)
+					if len(cells) == 0 { delete(q.Updates[sheetName], d.row) }
+				}
+				if _, inFlight := q.FlushUpdates[sheetName][d.row][d.col]; inFlight {
+					if rewrite[d.row] == nil { rewrite[d.row] = make(RowCells) }
+					rewrite[d.row][d.col] = d.val
+				}
+			}
+			if len(q.Updates[sheetName]) == 0 { delete(q.Updates, sheetName) }
+			journalCompact(sid, q)
+		}
+		STATE.QueueMutex.Unlock()
+		if len(rewrite) > 0 {
+			restore = QueueUpdateRows(sid, sheetName, rewrite)
+			log.Printf("🔁 [SYNC] %s/%s: %d dòng Operator thắng đang được Flush -> Ghi lại bản Operator", sid, sheetName, len(rewrite))
+		}
+	}
+	STATE.SheetMutex.Unlock()
+	restore.Wait()
+
+	if len(conflicts) > 0 {
+		QueueAppend(sid, SHEET_NAMES.ERROR_LOGGER, conflicts).Wait()
+		log.Printf("⚠️ [SYNC] %s/%s: %d ô xung đột (Đã ghi ErrorLogger)", sid, sheetName, len(conflicts))
+	}
+	if outside > 0 {
+		fmt.Printf("🔄 [SYNC] %s/%s: Nhận %d ô sửa tay từ Sheet.\n", sid, sheetName, outside)
+		if sheetName == SHEET_NAMES.DATA_TIKTOK { sealSheet(sid, cache) } // Operator gõ tay giá trị rõ -> Mã hóa lại
+	}
+	return true
+}
+
+// applyBlocksToBase: Store đã ghi thành công -> Cập nhật bản chụp Base tương ứng
+func applyBlocksToBase(sid string, blocks []CellBlock) {
+	STATE.SheetMutex.Lock()
+	defer STATE.SheetMutex.Unlock()
+
+	for _, b := range blocks {
+		cache, ok := STATE.SheetCache[sid+KEY_SEPARATOR+b.Sheet]
+		if !ok || cache.BaseValues == nil { continue }
+		for r, vals := range b.Values {
+			idx := b.Row + r
+			for len(cache.BaseValues) <= idx { cache.BaseValues = append(cache.BaseValues, []interface{}{}) }
+			row := cache.BaseValues[idx]
+			for len(row) < b.Col+len(vals) { row = append(row, "") }
+			copy(row[b.Col:], vals)
+			cache.BaseValues[idx] = row
+		}
+		cache.BaseGen++
+	}
+}
+
+// cellAt: Lấy ô an toàn (Ngoài phạm vi -> "")
+func cellAt(rows [][]interface{}, i, c int) interface{} {
+	if i < 0 || i >= len(rows) || c < 0 || c >= len(rows[i]) { return "" }
+	if rows[i][c] == nil { return "" }
+	return rows[i][c]
+}
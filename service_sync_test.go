@@ -0,0 +1,140 @@
+package main
+
+import "testing"
+
+func TestReconcileSheetMerge(t *testing.T) {
+	const col = 5 // Ngoài Status / DeviceId, không phải cột nhạy cảm
+	tests := []struct {
+		name             string
+		base, ours, them string
+		policy           string
+		want             string
+		wantConflict     bool
+		wantQueueDropped bool
+	}{
+		{"không ai sửa", "a", "a", "a", "sheet", "a", false, false},
+		{"chỉ Store (Operator) sửa", "a", "a", "b", "sheet", "b", false, false},
+		{"chỉ RAM sửa (Đang chờ ghi)", "a", "c", "a", "sheet", "c", false, false},
+		{"hai bên sửa giống nhau", "a", "b", "b", "sheet", "b", false, false},
+		{"xung đột - Operator thắng", "a", "c", "b", "sheet", "b", true, true},
+		{"xung đột - Tool thắng", "a", "c", "b", "queue", "c", true, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resetQueueForTest(t)
+			old := CACHE.CONFLICT_POLICY
+			CACHE.CONFLICT_POLICY = tc.policy
+			defer func() { CACHE.CONFLICT_POLICY = old }()
+
+			row := func(v string) []interface{} {
+				r := make([]interface{}, col+1)
+				for i := range r { r[i] = "" }
+				r[col] = v
+				return r
+			}
+			cache := buildSheetCache(SHEET_NAMES.DATA_TIKTOK, [][]interface{}{row(tc.base)})
+			cache.RawValues[0][col] = tc.ours
+			if tc.ours != tc.base { QueueUpdateCells("s", SHEET_NAMES.DATA_TIKTOK, 0, RowCells{col: tc.ours}) }
+
+			reconcileSheet("s", SHEET_NAMES.DATA_TIKTOK, cache, [][]interface{}{row(tc.them)}, cache.BaseGen)
+
+			if got := SafeString(cache.RawValues[0][col]); got != tc.want { t.Fatalf("cache = %q, want %q", got, tc.want) }
+			if got := SafeString(cache.BaseValues[0][col]); got != tc.them { t.Fatalf("base = %q, want %q", got, tc.them) }
+
+			STATE.QueueMutex.Lock()
+			q := getQueueLocked("s")
+			_, pending := q.Updates[SHEET_NAMES.DATA_TIKTOK][0][col]
+			conflicts := len(q.Appends[SHEET_NAMES.ERROR_LOGGER])
+			STATE.QueueMutex.Unlock()
+			if (conflicts > 0) != tc.wantConflict { t.Fatalf("conflicts = %d, want %v", conflicts, tc.wantConflict) }
+			if tc.ours != tc.base && pending == tc.wantQueueDropped { t.Fatalf("ô chờ ghi còn = %v, want %v", pending, !tc.wantQueueDropped) }
+		})
+	}
+}
+
+func TestReconcileSkipsStaleFresh(t *testing.T) {
+	resetQueueForTest(t)
+	cache := buildSheetCache(SHEET_NAMES.DATA_TIKTOK, [][]interface{}{{"", "", "", "", "", "old"}})
+	key := "s" + KEY_SEPARATOR + SHEET_NAMES.DATA_TIKTOK
+	STATE.SheetMutex.Lock()
+	STATE.SheetCache[key] = cache
+	STATE.SheetMutex.Unlock()
+	defer func() { STATE.SheetMutex.Lock(); delete(STATE.SheetCache, key); STATE.SheetMutex.Unlock() }()
+
+	// Đọc fresh (Còn "old") -> Flush ghi "new" & cập nhật Base -> Hợp nhất phải bỏ qua, không trả "old" về
+	gen := cache.BaseGen
+	fresh := [][]interface{}{{"", "", "", "", "", "old"}}
+	STATE.SheetMutex.Lock()
+	cache.RawValues[0][5] = "new"
+	STATE.SheetMutex.Unlock()
+	applyBlocksToBase("s", []CellBlock{{Sheet: SHEET_NAMES.DATA_TIKTOK, Row: 0, Col: 5, Values: [][]interface{}{{"new"}}}})
+
+	reconcileSheet("s", SHEET_NAMES.DATA_TIKTOK, cache, fresh, gen)
+	if got := SafeString(cache.RawValues[0][5]); got != "new" { t.Fatalf("cache = %q, want new", got) }
+}
+
+func TestRowFingerprint(t *testing.T) {
+	if rowFingerprint([]interface{}{"a", "b", ""}) != rowFingerprint([]interface{}{"a", "b"}) { t.Fatal("ô trống cuối dòng phải bị bỏ qua") }
+	if rowFingerprint([]interface{}{"ab", "c"}) == rowFingerprint([]interface{}{"a", "bc"}) { t.Fatal("ranh giới ô phải khác nhau") }
+	if rowFingerprint([]interface{}{"a", "", "", "", "cookie1"}) == rowFingerprint([]interface{}{"a", "", "", "", "cookie2"}) { t.Fatal("cột ngoài A..C phải được so") }
+}
+
+// countingStore: Đếm số lần LoadRows (Watcher chỉ được đọc cả Sheet khi phiên bản đổi)
+type countingStore struct {
+	*MemorySheetStore
+	loads int
+}
+
+func (c *countingStore) LoadRows(sid, sheetName string) ([][]interface{}, error) {
+	c.loads++
+	return c.MemorySheetStore.LoadRows(sid, sheetName)
+}
+
+func TestWatcherProbesVersionFirst(t *testing.T) {
+	resetQueueForTest(t)
+	store := &countingStore{MemorySheetStore: NewMemorySheetStore()}
+	sheetStore = store
+	rows := [][]interface{}{{"", "", "", "", "", "a"}}
+	store.AppendRows("s", SHEET_NAMES.DATA_TIKTOK, rows)
+	cache := cachedDataSheet(t, "s", rows)
+
+	check := func(wantLoads int) {
+		t.Helper()
+		if err := checkSheetChanged("s", SHEET_NAMES.DATA_TIKTOK); err != nil { t.Fatal(err) }
+		if store.loads != wantLoads { t.Fatalf("LoadRows = %d lần, want %d", store.loads, wantLoads) }
+	}
+	check(1) // Chưa biết phiên bản -> Đọc đầy đủ 1 lần
+	check(1) // Phiên bản không đổi -> Không đọc
+	store.WriteBlocks("s", []CellBlock{{Sheet: SHEET_NAMES.DATA_TIKTOK, Row: 0, Col: 5, Values: [][]interface{}{{"b"}}}})
+	check(2) // Operator sửa -> Đọc & hợp nhất
+	if got := SafeString(cache.RawValues[0][5]); got != "b" { t.Fatalf("cache = %q, want b", got) }
+
+	STATE.SheetMutex.Lock()
+	cache.FullCheckAt -= CACHE.CHANGE_FULL_MS
+	STATE.SheetMutex.Unlock()
+	check(3) // Quá CHANGE_FULL_MS -> Vẫn đọc đầy đủ
+}
+
+func TestOperatorWinsOverInFlightFlush(t *testing.T) {
+	resetQueueForTest(t)
+	old := CACHE.CONFLICT_POLICY
+	CACHE.CONFLICT_POLICY = "sheet"
+	defer func() { CACHE.CONFLICT_POLICY = old }()
+
+	cache := buildSheetCache(SHEET_NAMES.DATA_TIKTOK, [][]interface{}{{"", "", "", "", "", "a"}})
+	cache.RawValues[0][5] = "tool"
+	// Lượt Flush đang chạy đã rút ô "tool" khỏi Queue
+	STATE.QueueMutex.Lock()
+	q := getQueueLocked("s")
+	q.IsFlushing = true
+	q.FlushUpdates = map[string]map[int]RowCells{SHEET_NAMES.DATA_TIKTOK: {0: {5: "tool"}}}
+	STATE.QueueMutex.Unlock()
+
+	reconcileSheet("s", SHEET_NAMES.DATA_TIKTOK, cache, [][]interface{}{{"", "", "", "", "", "operator"}}, cache.BaseGen)
+	if got := SafeString(cache.RawValues[0][5]); got != "operator" { t.Fatalf("cache = %q, want operator", got) }
+
+	STATE.QueueMutex.Lock()
+	got := q.Updates[SHEET_NAMES.DATA_TIKTOK][0][5]
+	STATE.QueueMutex.Unlock()
+	if got != "operator" { t.Fatalf("ô chờ ghi sau lượt Flush = %v, want operator (Ghi lại bản Operator)", got) }
+}
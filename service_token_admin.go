@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// =================================================================================================
+// 🎫 QUẢN LÝ TOKEN (CẤP / GIA HẠN / THU HỒI / LIỆT KÊ)
+// =================================================================================================
+// - Token vẫn là Node TOKEN_TIKTOK/<token> trên Firebase (CheckToken đọc như cũ), không cần tạo tay trên Console.
+// - /tool/tokens KHÔNG nhận Token Tenant: Dùng khóa vận hành riêng (Env TOKEN_ADMIN_KEY, Header X-Admin-Key) & chỉ rõ
+//   "spreadsheetId" trong Body. Không cấu hình khóa -> Tắt API.
+// - Giới hạn: Hạn tối đa TOKEN_RULES.MAX_DAYS ngày tính từ hiện tại, "data" chỉ nhận các khóa trong TOKEN_RULES.DATA_KEYS,
+//   "scopes" chỉ nhận "admin" / "read:<nhóm>" / "write:<nhóm>" (SCOPES.COLUMN_GROUPS).
+//   Không gửi "scopes" -> Ghi rõ SCOPES.DEFAULT (Quyền tối thiểu). Token thiếu trường này được coi là Token cũ (Toàn quyền).
+// - Thu hồi = Ghi "blocked": true + Xóa Cache RAM ngay -> Request kế tiếp đọc lại Firebase và bị chặn ("Token bị block").
+//   Các Server khác nhận thay đổi trong vài giây qua RunTokenWatcher (service_token_watch.go).
+// - Liệt kê dùng Query theo spreadsheetId. Nên thêm ".indexOn": ["spreadsheetId"] cho TOKEN_TIKTOK trong Rules,
+//   thiếu Index -> Tự chuyển sang đọc toàn bộ Node rồi lọc.
+
+const tokenRoot = "TOKEN_TIKTOK"
+
+type TokenInfo struct {
+	Token     string      `json:"token"`
+	Expired   string      `json:"expired"`
+	ExpiresAt int64       `json:"expires_at"`
+	Valid     bool        `json:"valid"`
+	Blocked   bool        `json:"blocked"`
+	Scopes    interface{} `json:"scopes,omitempty"`
+	Note      string      `json:"note,omitempty"`
+	CreatedAt string      `json:"created_at,omitempty"`
+}
+
+// OperatorMiddleware: Xác thực khóa vận hành (So sánh thời gian hằng) thay cho AuthMiddleware
+func OperatorMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deny := func(code int, msg string) {
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(map[string]string{"status": "false", "messenger": msg})
+		}
+		if !CheckGlobalRateLimit() { deny(503, "Server Busy (Global Limit)"); return }
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil { ip = r.RemoteAddr }
+		if !CheckUserRateLimit("operator:" + ip) { deny(429, "Spam detected (Rate Limit)"); return }
+
+		want := strings.TrimSpace(os.Getenv("TOKEN_ADMIN_KEY"))
+		if want == "" { deny(403, "Chưa cấu hình TOKEN_ADMIN_KEY"); return }
+		got, want2 := sha256.Sum256([]byte(strings.TrimSpace(r.Header.Get("X-Admin-Key")))), sha256.Sum256([]byte(want))
+		if subtle.ConstantTimeCompare(got[:], want2[:]) != 1 {
+			log.Printf("⚠️ [TOKEN] Sai khóa vận hành từ %s", ip)
+			deny(401, "Sai khóa vận hành")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// newTokenSecret: Chuỗi Hex ngẫu nhiên (crypto/rand)
+func newTokenSecret() (string, error) {
+	n := TOKEN_RULES.SECRET_BYTES
+	if n*2 < TOKEN_RULES.MIN_LENGTH { n = (TOKEN_RULES.MIN_LENGTH + 1) / 2 }
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil { return "", err }
+	return hex.EncodeToString(b), nil
+}
+
+// tokenExpiry: Hạn mới từ Body ("expired" dạng bất kỳ parseSmartTime hiểu, hoặc "days" tính từ mốc base)
+func tokenExpiry(body map[string]interface{}, base time.Time) (string, error) {
+	vnZone := VN_ZONE
+	if s := SafeString(body["expired"]); s != "" {
+		t := parseSmartTime(s)
+		if t.IsZero() { return "", fmt.Errorf("expired không hợp lệ") }
+		if !t.After(time.Now()) { return "", fmt.Errorf("expired phải ở tương lai") }
+		if t.After(time.Now().AddDate(0, 0, TOKEN_RULES.MAX_DAYS)) { return "", fmt.Errorf("Hạn tối đa %d ngày kể từ hôm nay", TOKEN_RULES.MAX_DAYS) }
+		return t.In(vnZone).Format("02/01/2006 15:04:05"), nil
+	}
+	days := float64(TOKEN_RULES.DEFAULT_DAYS)
+	if v, ok := toFloat(body["days"]); ok { days = v }
+	if days <= 0 { return "", fmt.Errorf("days phải lớn hơn 0") }
+	if days > float64(TOKEN_RULES.MAX_DAYS) { return "", fmt.Errorf("days tối đa %d", TOKEN_RULES.MAX_DAYS) }
+	t := base.Add(time.Duration(days * float64(24*time.Hour)))
+	if t.After(time.Now().AddDate(0, 0, TOKEN_RULES.MAX_DAYS)) { return "", fmt.Errorf("Hạn tối đa %d ngày kể từ hôm nay", TOKEN_RULES.MAX_DAYS) }
+	return t.In(vnZone).Format("02/01/2006 15:04:05"), nil
+}
+
+// tokenDataFields: Chỉ giữ các khóa cấu hình được phép (TOKEN_RULES.DATA_KEYS)
+func tokenDataFields(body map[string]interface{}) (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+	raw, ok := body["data"]
+	if !ok || raw == nil { return out, nil }
+	extra, ok := raw.(map[string]interface{})
+	if !ok { return nil, fmt.Errorf("data phải là Object") }
+	for k, v := range extra {
+		allowed := false
+		for _, a := range TOKEN_RULES.DATA_KEYS {
+			if k == a { allowed = true; break }
+		}
+		if !allowed { return nil, fmt.Errorf("data không được chứa %q", k) }
+		out[k] = v
+	}
+	return out, nil
+}
+
+// tokenScopeList: "scopes" hợp lệ (Mảng hoặc chuỗi phân cách dấu phẩy), nil = Không gửi -> IssueToken ghi SCOPES.DEFAULT.
+// Gửi mà rỗng -> Lỗi (Firebase bỏ mảng rỗng, Token sẽ thành Token cũ toàn quyền).
+func tokenScopeList(body map[string]interface{}) ([]string, error) {
+	var raw []string
+	switch v := body["scopes"].(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		for _, s := range v { raw = append(raw, SafeString(s)) }
+	case string:
+		raw = strings.Split(v, ",")
+	default:
+		return nil, fmt.Errorf("scopes không hợp lệ")
+	}
+	out := []string{}
+	for _, s := range raw {
+		s = CleanString(s)
+		if s == "" { continue }
+		_, group := SCOPES.COLUMN_GROUPS[strings.TrimPrefix(strings.TrimPrefix(s, "read:"), "write:")]
+		if s != SCOPES.ADMIN && !(group && (strings.HasPrefix(s, "read:") || strings.HasPrefix(s, "write:"))) {
+			return nil, fmt.Errorf("scope không hợp lệ: %s", s)
+		}
+		out = append(out, s)
+	}
+	if len(out) == 0 { return nil, fmt.Errorf("scopes trống") }
+	return out, nil
+}
+
+// loadTenantToken: Đọc Node Token & kiểm tra thuộc đúng spreadsheetId
+func loadTenantToken(sid, token string) (map[string]interface{}, error) {
+	if firebaseDB == nil { return nil, fmt.Errorf("Chưa kết nối Firebase") }
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, ".$#[]/") { return nil, fmt.Errorf("Thiếu target_token") }
+	var data map[string]interface{}
+	if err := firebaseDB.NewRef(tokenRoot+"/"+token).Get(context.Background(), &data); err != nil {
+		log.Printf("❌ [FIREBASE ERROR] %v", err)
+		return nil, fmt.Errorf("Lỗi kết nối Database")
+	}
+	if data == nil || sid == "" || SafeString(data["spreadsheetId"]) != sid { return nil, fmt.Errorf("Token không tồn tại") }
+	return data, nil
+}
+
+// IssueToken: Cấp Token mới cho sid
+func IssueToken(sid string, body map[string]interface{}) (string, map[string]interface{}, error) {
+	if firebaseDB == nil { return "", nil, fmt.Errorf("Chưa kết nối Firebase") }
+	if sid == "" { return "", nil, fmt.Errorf("Thiếu spreadsheetId") }
+	exp, err := tokenExpiry(body, time.Now())
+	if err != nil { return "", nil, err }
+	token, err := newTokenSecret()
+	if err != nil { return "", nil, fmt.Errorf("Không sinh được Token") }
+
+	// Cấu hình thêm của Token (timezone, proxy_pool, ...) -> Chỉ các khóa trong TOKEN_RULES.DATA_KEYS
+	rec, err := tokenDataFields(body)
+	if err != nil { return "", nil, err }
+	scopes, err := tokenScopeList(body)
+	if err != nil { return "", nil, err }
+	if scopes == nil { scopes = append([]string(nil), SCOPES.DEFAULT...) }
+	rec["scopes"] = scopes // Luôn ghi rõ: Thiếu trường = Token cũ (Toàn quyền)
+	if v := SafeString(body["note"]); v != "" { rec["note"] = v }
+	rec["spreadsheetId"] = sid
+	rec["expired"] = exp
+	rec["blocked"] = false
+	rec["created_at"] = time.Now().UnixMilli()
+
+	if err := firebaseDB.NewRef(tokenRoot+"/"+token).Set(context.Background(), rec); err != nil {
+		log.Printf("❌ [FIREBASE ERROR] %v", err)
+		return "", nil, fmt.Errorf("Lỗi kết nối Database")
+	}
+	return token, rec, nil
+}
+
+// ExtendToken: Gia hạn (days cộng từ hạn cũ nếu còn hạn, ngược lại từ hiện tại) & mở block
+func ExtendToken(sid, token string, body map[string]interface{}) (string, error) {
+	data, err := loadTenantToken(sid, token)
+	if err != nil { return "", err }
+	base := time.Now()
+	if t := parseSmartTime(SafeString(data["expired"])); t.After(base) { base = t }
+	exp, err := tokenExpiry(body, base)
+	if err != nil { return "", err }
+
+	if err := firebaseDB.NewRef(tokenRoot+"/"+token).Update(context.Background(), map[string]interface{}{"expired": exp, "blocked": false}); err != nil {
+		log.Printf("❌ [FIREBASE ERROR] %v", err)
+		return "", fmt.Errorf("Lỗi kết nối Database")
+	}
+	deleteTokenCache(token)
+	return exp, nil
+}
+
+// RevokeToken: Chặn Token & xóa Cache ngay (Không chờ hết CACHE_TTL_MS)
+func RevokeToken(sid, token string) error {
+	if _, err := loadTenantToken(sid, token); err != nil { return err }
+	if err := firebaseDB.NewRef(tokenRoot+"/"+token).Update(context.Background(), map[string]interface{}{"blocked": true, "revoked_at": time.Now().UnixMilli()}); err != nil {
+		log.Printf("❌ [FIREBASE ERROR] %v", err)
+		return fmt.Errorf("Lỗi kết nối Database")
+	}
+	deleteTokenCache(token)
+	return nil
+}
+
+// ListTokens: Token của sid (Sắp theo hạn tăng dần)
+func ListTokens(sid string) ([]TokenInfo, error) {
+	if firebaseDB == nil { return nil, fmt.Errorf("Chưa kết nối Firebase") }
+	ctx := context.Background()
+	var nodes map[string]map[string]interface{}
+	if err := firebaseDB.NewRef(tokenRoot).OrderByChild("spreadsheetId").EqualTo(sid).Get(ctx, &nodes); err != nil {
+		log.Printf("⚠️ [TOKEN] Query theo spreadsheetId lỗi (Thiếu .indexOn?): %v -> Đọc toàn bộ", err)
+		nodes = nil
+		if err := firebaseDB.NewRef(tokenRoot).Get(ctx, &nodes); err != nil {
+			log.Printf("❌ [FIREBASE ERROR] %v", err)
+			return nil, fmt.Errorf("Lỗi kết nối Database")
+		}
+	}
+
+	now := time.Now()
+	list := []TokenInfo{}
+	for token, data := range nodes {
+		if data == nil || SafeString(data["spreadsheetId"]) != sid { continue }
+		exp := SafeString(data["expired"])
+		t := parseSmartTime(exp)
+		blocked := tokenBlocked(data)
+		it := TokenInfo{Token: token, Expired: exp, Blocked: blocked, Scopes: data["scopes"], Note: SafeString(data["note"]), CreatedAt: SafeString(data["created_at"])}
+		if !t.IsZero() { it.ExpiresAt = t.UnixMilli() }
+		it.Valid = !blocked && t.After(now)
+		list = append(list, it)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].ExpiresAt < list[j].ExpiresAt })
+	return list, nil
+}
+
+// tokenBlocked: Trường "blocked" (bool / "true" / 1)
+func tokenBlocked(data map[string]interface{}) bool {
+	switch v := data["blocked"].(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		s := CleanString(v)
+		return s == "true" || s == "1"
+	}
+	return false
+}
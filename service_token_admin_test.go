@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOperatorMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		header string
+		want   int
+	}{
+		{"chưa cấu hình khóa", "", "abc", 403},
+		{"thiếu khóa", "secret-key", "", 401},
+		{"sai khóa", "secret-key", "secret-kez", 401},
+		{"đúng khóa", "secret-key", "secret-key", 200},
+	}
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TOKEN_ADMIN_KEY", tc.env)
+			h := OperatorMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
+			r := httptest.NewRequest("POST", "/tool/tokens", strings.NewReader(`{}`))
+			r.RemoteAddr = "10.0.0." + strconv.Itoa(i+1) + ":1234" // Mỗi case 1 IP (Không dính Rate Limit)
+			r.Header.Set("X-Admin-Key", tc.header)
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tc.want { t.Fatalf("code = %d, want %d (%s)", w.Code, tc.want, w.Body.String()) }
+		})
+	}
+}
+
+func TestTokenExpiryCap(t *testing.T) {
+	now := time.Now()
+	far := now.AddDate(0, 0, TOKEN_RULES.MAX_DAYS+5).In(VN_ZONE).Format("02/01/2006 15:04:05")
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		base time.Time
+		ok   bool
+	}{
+		{"mặc định", map[string]interface{}{}, now, true},
+		{"days hợp lệ", map[string]interface{}{"days": 30.0}, now, true},
+		{"days âm", map[string]interface{}{"days": -1.0}, now, false},
+		{"days vượt trần", map[string]interface{}{"days": 1e9}, now, false},
+		{"gia hạn dồn quá trần", map[string]interface{}{"days": 30.0}, now.AddDate(0, 0, TOKEN_RULES.MAX_DAYS-10), false},
+		{"expired vượt trần", map[string]interface{}{"expired": far}, now, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tokenExpiry(tc.body, tc.base)
+			if (err == nil) != tc.ok { t.Fatalf("err = %v, want ok = %v", err, tc.ok) }
+		})
+	}
+}
+
+func TestTokenFieldWhitelist(t *testing.T) {
+	if _, err := tokenDataFields(map[string]interface{}{"data": map[string]interface{}{"timezone": "+7", "spreadsheetId": "x"}}); err == nil {
+		t.Fatal("data chứa trường hệ thống phải lỗi")
+	}
+	rec, err := tokenDataFields(map[string]interface{}{"data": map[string]interface{}{"timezone": "+7", "device_slots": 2.0}})
+	if err != nil || len(rec) != 2 { t.Fatalf("rec = %v, %v", rec, err) }
+
+	for _, bad := range []interface{}{"read:secret", "root", []interface{}{"write:status", "write:*"}, 1.0} {
+		if _, err := tokenScopeList(map[string]interface{}{"scopes": bad}); err == nil { t.Errorf("%v: phải lỗi", bad) }
+	}
+	got, err := tokenScopeList(map[string]interface{}{"scopes": "read:auth, write:status,admin"})
+	if err != nil || len(got) != 3 { t.Fatalf("scopes = %v, %v", got, err) }
+	if got, _ := tokenScopeList(map[string]interface{}{}); got != nil { t.Fatalf("không gửi scopes -> nil, got %v", got) }
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// =================================================================================================
+// 📡 LAN TRUYỀN THU HỒI TOKEN (DÒ NODE TOKEN_TIKTOK)
+// =================================================================================================
+// - SDK Admin Go không có Listener Realtime -> Chạy nền mỗi TOKEN_RULES.WATCH_MS gọi GetIfChanged (ETag):
+//   Node không đổi -> Firebase trả 304, không tải dữ liệu. Có đổi -> Tải 1 lần toàn bộ TOKEN_TIKTOK.
+// - So "dấu vân tay" (expired | blocked | spreadsheetId | scopes) của từng Token với bản đang Cache:
+//   Khác hoặc Node đã bị xóa -> Xóa Cache -> Request kế tiếp đọc lại Firebase (CheckToken),
+//   Token bị block trả "Token bị block" (isFatalError -> status "error").
+// - Cache chặn (Negative) cũng bị xóa khi Token đổi so với lượt trước (Vừa gia hạn / mở block có hiệu lực ngay).
+// - Sửa tay trên Console, /tool/tokens ở Server khác đều được phát hiện trong vài giây.
+
+var tokenWatch = struct {
+	sync.Mutex
+	ETag   string
+	Prints map[string]string // token -> Dấu vân tay ở lượt trước
+}{
+	Prints: make(map[string]string),
+}
+
+// RunTokenWatcher: Chạy nền (main.go)
+func RunTokenWatcher() {
+	ticker := time.NewTicker(time.Duration(TOKEN_RULES.WATCH_MS) * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		pollTokenChanges()
+	}
+}
+
+// tokenFingerprint: Các trường quyết định Token còn dùng được / thuộc Sheet nào
+func tokenFingerprint(data map[string]interface{}) string {
+	if data == nil { return "" }
+	return fmt.Sprintf("%s|%t|%s|%v", SafeString(data["expired"]), tokenBlocked(data), SafeString(data["spreadsheetId"]), data["scopes"])
+}
+
+// pollTokenChanges: 1 lượt dò, trả về số Token bị xóa Cache
+func pollTokenChanges() int {
+	if firebaseDB == nil { return 0 }
+	tokenWatch.Lock()
+	defer tokenWatch.Unlock()
+
+	var nodes map[string]interface{}
+	changed, etag, err := firebaseDB.NewRef(tokenRoot).GetIfChanged(context.Background(), tokenWatch.ETag, &nodes)
+	if err != nil {
+		log.Printf("⚠️ [TOKEN WATCH] %v", err)
+		return 0
+	}
+	if !changed { return 0 }
+
+	prints := make(map[string]string, len(nodes))
+	for token, v := range nodes {
+		data, _ := v.(map[string]interface{})
+		prints[token] = tokenFingerprint(data)
+	}
+	first := tokenWatch.ETag == ""
+	n := invalidateChangedTokens(prints, tokenWatch.Prints, first)
+	tokenWatch.ETag, tokenWatch.Prints = etag, prints
+
+	if n > 0 { fmt.Printf("🔄 [TOKEN WATCH] Xóa Cache %d Token thay đổi trên Firebase.\n", n) }
+	return n
+}
+
+// invalidateChangedTokens: Xóa Cache Token có dấu vân tay khác bản mới
+// - Cache đúng: So với dữ liệu đang Cache
+// - Cache chặn: So với lượt trước (Lượt đầu bỏ qua, chưa có mốc so)
+func invalidateChangedTokens(prints, prev map[string]string, first bool) int {
+	STATE.TokenMutex.Lock()
+	defer STATE.TokenMutex.Unlock()
+
+	n := 0
+	for token, c := range STATE.TokenCache {
+		now, exists := prints[token]
+		stale := false
+		if !c.IsInvalid {
+			stale = !exists || now != tokenFingerprint(c.Data.Data)
+		} else if !first {
+			stale = now != prev[token]
+		}
+		if stale {
+			delete(STATE.TokenCache, token)
+			n++
+		}
+	}
+	return n
+}
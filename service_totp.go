@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =================================================================================================
+// 🔐 MÃ 2FA (TOTP - RFC 6238) TỪ CỘT TWO_FA
+// =================================================================================================
+// - Server tự sinh mã thay cho Tool: /tool/2fa và /tool/login { "with_totp": true }.
+// - Định dạng Secret trong Sheet: Base32 (Có dấu cách / gạch ngang, chữ thường đều được)
+//   hoặc URI "otpauth://totp/...?secret=...&digits=6&period=30&algorithm=SHA1".
+// - Digits / Period: Body > URI > TOTP mặc định.
+
+type TotpResult struct {
+	Code      string `json:"code"`       // Mã hiện tại
+	NextCode  string `json:"next_code"`  // Mã của chu kỳ kế tiếp
+	ExpiresIn int    `json:"expires_in"` // Số giây còn lại của mã hiện tại
+	Digits    int    `json:"digits"`
+	Period    int    `json:"period"`
+}
+
+type totpParams struct {
+	Secret    []byte
+	Digits    int
+	Period    int
+	Algorithm string
+}
+
+// parseTotpSecret: Đọc Secret (Base32 / otpauth://) -> Tham số sinh mã
+func parseTotpSecret(raw string) (*totpParams, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" { return nil, fmt.Errorf("Nick không có 2FA") }
+	p := &totpParams{Digits: TOTP.DEFAULT_DIGITS, Period: TOTP.DEFAULT_PERIOD, Algorithm: "SHA1"}
+
+	secret := raw
+	if strings.HasPrefix(strings.ToLower(raw), "otpauth://") {
+		u, err := url.Parse(raw)
+		if err != nil { return nil, fmt.Errorf("URI 2FA không hợp lệ") }
+		q := u.Query()
+		secret = q.Get("secret")
+		if v, err := strconv.Atoi(q.Get("digits")); err == nil { p.Digits = v }
+		if v, err := strconv.Atoi(q.Get("period")); err == nil { p.Period = v }
+		if a := strings.ToUpper(q.Get("algorithm")); a != "" { p.Algorithm = a }
+	}
+
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil || len(key) == 0 { return nil, fmt.Errorf("Secret 2FA không hợp lệ (Base32)") }
+	p.Secret = key
+	return p, nil
+}
+
+// GenerateTotp: Mã hiện tại & kế tiếp. digits / period = 0 -> Theo URI hoặc mặc định.
+func GenerateTotp(raw string, digits, period int) (*TotpResult, error) {
+	return generateTotpAt(raw, digits, period, time.Now())
+}
+
+// generateTotpAt: GenerateTotp tại mốc thời gian cho trước
+func generateTotpAt(raw string, digits, period int, at time.Time) (*TotpResult, error) {
+	p, err := parseTotpSecret(raw)
+	if err != nil { return nil, err }
+	if digits > 0 { p.Digits = digits }
+	if period > 0 { p.Period = period }
+	if p.Digits < TOTP.MIN_DIGITS || p.Digits > TOTP.MAX_DIGITS { return nil, fmt.Errorf("Digits phải từ %d đến %d", TOTP.MIN_DIGITS, TOTP.MAX_DIGITS) }
+	if p.Period <= 0 { return nil, fmt.Errorf("Period không hợp lệ") }
+
+	var h func() hash.Hash
+	switch p.Algorithm {
+	case "SHA1": h = sha1.New
+	case "SHA256": h = sha256.New
+	case "SHA512": h = sha512.New
+	default: return nil, fmt.Errorf("Thuật toán 2FA không hỗ trợ (%s)", p.Algorithm)
+	}
+
+	now := at.Unix()
+	counter := uint64(now / int64(p.Period))
+	return &TotpResult{
+		Code:      hotp(h, p.Secret, counter, p.Digits),
+		NextCode:  hotp(h, p.Secret, counter+1, p.Digits),
+		ExpiresIn: p.Period - int(now%int64(p.Period)),
+		Digits:    p.Digits,
+		Period:    p.Period,
+	}, nil
+}
+
+// hotp: RFC 4226 (Dynamic Truncation)
+func hotp(h func() hash.Hash, key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(h, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ { mod *= 10 }
+	return fmt.Sprintf("%0*d", digits, bin%mod)
+}
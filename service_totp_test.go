@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 - Appendix B (8 chữ số, chu kỳ 30 giây)
+func TestTotpRFC6238Vectors(t *testing.T) {
+	seeds := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	tests := []struct {
+		unix int64
+		algo string
+		want string
+	}{
+		{59, "SHA1", "94287082"}, {59, "SHA256", "46119246"}, {59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"}, {1111111109, "SHA256", "68084774"}, {1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"}, {1111111111, "SHA256", "67062674"}, {1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"}, {1234567890, "SHA256", "91819424"}, {1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"}, {2000000000, "SHA256", "90698825"}, {2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"}, {20000000000, "SHA256", "77737706"}, {20000000000, "SHA512", "47863826"},
+	}
+	for _, tc := range tests {
+		secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(seeds[tc.algo]))
+		uri := "otpauth://totp/test?secret=" + secret + "&digits=8&period=30&algorithm=" + tc.algo
+		res, err := generateTotpAt(uri, 0, 0, time.Unix(tc.unix, 0))
+		if err != nil { t.Fatalf("%s @%d: %v", tc.algo, tc.unix, err) }
+		if res.Code != tc.want { t.Errorf("%s @%d: code = %s, want %s", tc.algo, tc.unix, res.Code, tc.want) }
+	}
+}
+
+func TestTotpSecretFormats(t *testing.T) {
+	raw := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	at := time.Unix(59, 0)
+	want, _ := generateTotpAt(raw, 8, 0, at)
+	if want.Code != "94287082" { t.Fatalf("base32 thuần: %s", want.Code) }
+
+	spaced := strings.ToLower(raw[:4] + " " + raw[4:8] + "-" + raw[8:])
+	for _, s := range []string{spaced, raw + "===="} {
+		res, err := generateTotpAt(s, 8, 0, at)
+		if err != nil || res.Code != want.Code { t.Errorf("%q: %v %v", s, res, err) }
+	}
+
+	res, _ := generateTotpAt(raw, 6, 0, time.Unix(29, 0))
+	if res.ExpiresIn != 1 || res.NextCode == res.Code { t.Errorf("expires_in / next_code sai: %+v", res) }
+
+	for _, bad := range []string{"", "not base32!", "otpauth://totp/x?secret=" + raw + "&algorithm=MD5"} {
+		if _, err := generateTotpAt(bad, 0, 0, at); err == nil { t.Errorf("%q: phải lỗi", bad) }
+	}
+	if _, err := generateTotpAt(raw, 4, 0, at); err == nil { t.Error("digits < MIN_DIGITS phải lỗi") }
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"hash/fnv"
 	"math"
 	"regexp"
 	"strconv"
@@ -22,6 +23,7 @@ var REGEX_INVISIBLE = regexp.MustCompile(`[\x{00A0}\x{200B}\x{200C}\x{200D}\x{FE
 var (
 	REGEX_DATE  = regexp.MustCompile(`(\d{1,2}\/\d{1,2}\/\d{4})`)
 	REGEX_COUNT = regexp.MustCompile(`\(Lần\s*(\d+)\)`)
+	REGEX_NOTE_TIME = regexp.MustCompile(`\d{2}\/\d{2}\/\d{4} \d{2}:\d{2}:\d{2}`)
 )
 
 func CleanString(v interface{}) string {
@@ -72,11 +74,18 @@ func ToSlice(v interface{}) []string {
 	return []string{}
 }
 
+// VN_ZONE: Giờ VN cố định (+7) cho mọi mốc ghi vào Note / đọc lại từ Note.
+// Không dùng giờ máy chủ (Container đặt TZ=Asia/Ho_Chi_Minh, Cloud Run chạy UTC -> Lệch nhau 7 giờ).
+var VN_ZONE = time.FixedZone("UTC+7", 7*3600)
+
+// nowVN: Giờ hiện tại theo VN_ZONE
+func nowVN() time.Time { return time.Now().In(VN_ZONE) }
+
 func ConvertSerialDate(v interface{}) int64 {
 	s := fmt.Sprintf("%v", v)
 	if strings.Contains(s, "/") {
-		if t, err := time.ParseInLocation("02/01/2006 15:04:05", s, time.FixedZone("UTC+7", 7*3600)); err == nil { return t.UnixMilli() }
-		if t, err := time.ParseInLocation("02/01/2006", s, time.FixedZone("UTC+7", 7*3600)); err == nil { return t.UnixMilli() }
+		if t, err := time.ParseInLocation("02/01/2006 15:04:05", s, VN_ZONE); err == nil { return t.UnixMilli() }
+		if t, err := time.ParseInLocation("02/01/2006", s, VN_ZONE); err == nil { return t.UnixMilli() }
 	}
 	val := 0.0
 	if f, ok := v.(float64); ok { val = f } else if f, err := strconv.ParseFloat(s, 64); err == nil { val = f }
@@ -89,6 +98,18 @@ func ConvertSerialDate(v interface{}) int64 {
 	return 0
 }
 
+// SafeIdent: Chuẩn hóa chuỗi bất kỳ thành tên định danh an toàn (Tên bảng SQL, tên file...).
+// Kèm mã băm của chuỗi gốc vì spreadsheetId phân biệt hoa/thường.
+func SafeIdent(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(raw) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') { b.WriteRune(r) } else { b.WriteRune('_') }
+	}
+	h := fnv.New32a()
+	h.Write([]byte(raw))
+	return fmt.Sprintf("%s_%08x", b.String(), h.Sum32())
+}
+
 // =================================================================================================
 // 🟢 2. CÁC HÀM QUẢN LÝ MAP/LIST DÙNG CHUNG
 // =================================================================================================
@@ -265,7 +286,7 @@ func KiemTraChatLuongClean(cleanRow []string, action string) QualityResult {
 	return QualityResult{false, "", "unknown"}
 }
 
-type AuthProfile struct { Status string `json:"status"`; Note string `json:"note"`; DeviceId string `json:"device_id"`; UserId string `json:"user_id"`; UserSec string `json:"user_sec"`; UserName string `json:"user_name"`; Email string `json:"email"`; NickName string `json:"nick_name"`; Password string `json:"password"`; PasswordEmail string `json:"password_email"`; RecoveryEmail string `json:"recovery_email"`; TwoFa string `json:"two_fa"`; Phone string `json:"phone"`; Birthday string `json:"birthday"`; ClientId string `json:"client_id"`; RefreshToken string `json:"refresh_token"`; AccessToken string `json:"access_token"`; Cookie string `json:"cookie"`; UserAgent string `json:"user_agent"`; Proxy string `json:"proxy"`; ProxyExpired string `json:"proxy_expired"`; CreateCountry string `json:"create_country"`; CreateTime string `json:"create_time"` }
+type AuthProfile struct { Status string `json:"status"`; Note string `json:"note"`; DeviceId string `json:"device_id"`; UserId string `json:"user_id"`; UserSec string `json:"user_sec"`; UserName string `json:"user_name"`; Email string `json:"email"`; NickName string `json:"nick_name"`; Password string `json:"password"`; PasswordEmail string `json:"password_email"`; RecoveryEmail string `json:"recovery_email"`; TwoFa string `json:"two_fa"`; Phone string `json:"phone"`; Birthday string `json:"birthday"`; ClientId string `json:"client_id"`; RefreshToken string `json:"refresh_token"`; AccessToken string `json:"access_token"`; Cookie string `json:"cookie"`; UserAgent string `json:"user_agent"`; Proxy string `json:"proxy"`; ProxyExpired string `json:"proxy_expired"`; ProxyDetail *ProxyInfo `json:"proxy_detail,omitempty"`; CreateCountry string `json:"create_country"`; CreateTime string `json:"create_time"` }
 type ActivityProfile struct { StatusPost string `json:"status_post"`; DailyPostLimit string `json:"daily_post_limit"`; TodayPostCount string `json:"today_post_count"`; DailyFollowLimit string `json:"daily_follow_limit"`; TodayFollowCount string `json:"today_follow_count"`; LastActiveDate string `json:"last_active_date"`; FollowerCount string `json:"follower_count"`; FollowingCount string `json:"following_count"`; LikesCount string `json:"likes_count"`; VideoCount string `json:"video_count"`; StatusLive string `json:"status_live"`; LivePhoneAccess string `json:"live_phone_access"`; LiveStudioAccess string `json:"live_studio_access"`; LiveKey string `json:"live_key"`; LastLiveDuration string `json:"last_live_duration"`; ShopRole string `json:"shop_role"`; ShopId string `json:"shop_id"`; ProductCount string `json:"product_count"`; ShopHealth string `json:"shop_health"`; TotalOrders string `json:"total_orders"`; TotalRevenue string `json:"total_revenue"`; CommissionRate string `json:"commission_rate"` }
 type AiProfile struct { Signature string `json:"signature"`; DefaultCategory string `json:"default_category"`; DefaultProduct string `json:"default_product"`; PreferredKeywords string `json:"preferred_keywords"`; PreferredHashtags string `json:"preferred_hashtags"`; WritingStyle string `json:"writing_style"`; MainGoal string `json:"main_goal"`; DefaultCta string `json:"default_cta"`; ContentLength string `json:"content_length"`; ContentType string `json:"content_type"`; TargetAudience string `json:"target_audience"`; VisualStyle string `json:"visual_style"`; AiPersona string `json:"ai_persona"`; BannedKeywords string `json:"banned_keywords"`; ContentLanguage string `json:"content_language"`; Country string `json:"country"` }
 